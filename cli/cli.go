@@ -0,0 +1,330 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/azr4e1/polacco/engine"
+	"github.com/azr4e1/polacco/history"
+	"github.com/azr4e1/polacco/rpn"
+	"github.com/azr4e1/polacco/shell"
+	"github.com/azr4e1/polacco/ui"
+)
+
+// Version is printed by --version. Releases set it at build time with
+// -ldflags "-X github.com/azr4e1/polacco/cli.Version=v1.2.3".
+var Version = "dev"
+
+var Usage = `usage: polacco [--help] [--version] [command] [flags] [args]
+
+commands:
+  tui              run the calculator in the terminal (the default)
+  repl             run a line-based shell
+  eval <expr>...   evaluate an expression and print the result
+  run [file]...    run scripts without prompts and print the final stack;
+                   - or no file reads standard input
+
+tui and repl save the session on exit and restore it on the next launch;
+-precision and -stack apply on top of the restored session, and -mode
+must match its mode; -clean starts a clean session instead.
+Both keep the lines typed in ~/.polacco_history, shared between sessions.
+
+Run polacco <command> --help for the flags of a command.
+`
+
+// Exit statuses.
+const (
+	ExitOK    = 0
+	ExitError = 1
+	ExitUsage = 2
+)
+
+// config holds the flags shared by the commands.
+type config struct {
+	mode        string
+	precision   int
+	stack       stackValue
+	top         bool
+	stateFile   string
+	clean       bool
+	historyFile string
+	histControl histControlValue
+	histSize    int
+}
+
+// stackValue is a flag holding numbers separated by spaces or commas. It
+// can be repeated, each time pushing more numbers.
+type stackValue []float64
+
+func (v *stackValue) String() string {
+	vals := []string{}
+	for _, val := range *v {
+		vals = append(vals, strconv.FormatFloat(val, 'g', -1, 64))
+	}
+
+	return strings.Join(vals, " ")
+}
+
+func (v *stackValue) Set(value string) error {
+	fields := strings.FieldsFunc(value, func(ch rune) bool { return ch == ',' || ch == ' ' })
+	for _, field := range fields {
+		val, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number: %s", field)
+		}
+		*v = append(*v, val)
+	}
+
+	return nil
+}
+
+// histControlValue is a flag holding a history mode written as in
+// HISTCONTROL, such as ignoreboth.
+type histControlValue history.Mode
+
+func (v *histControlValue) String() string {
+	return history.Mode(*v).String()
+}
+
+func (v *histControlValue) Set(value string) error {
+	mode, err := history.ParseMode(value)
+	*v = histControlValue(mode)
+
+	return err
+}
+
+// Main runs the command line in args, without the program name, and
+// returns the exit status.
+func Main(args []string) int {
+	return Run(args, os.Stdin, os.Stdout, os.Stderr)
+}
+
+// Run is like Main, but reads and writes the given streams. The terminal
+// calculator always uses those of the process.
+func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("polacco", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), Usage) }
+	version := flags.Bool("version", false, "print the version and exit")
+	if err := flags.Parse(args); err != nil {
+		return helpStatus(err)
+	}
+	if *version {
+		fmt.Fprintln(stdout, "polacco", Version)
+		return ExitOK
+	}
+
+	command, args := "tui", flags.Args()
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "tui":
+		return tui(args, stderr)
+	case "repl":
+		return repl(args, stdin, stdout, stderr)
+	case "eval":
+		return eval(args, stdin, stdout, stderr)
+	case "run":
+		return run(args, stdin, stdout, stderr)
+	case "help":
+		fmt.Fprint(stdout, Usage)
+		return ExitOK
+	}
+	fmt.Fprintf(stderr, "error: unknown command: %s\n", command)
+	fmt.Fprint(stderr, Usage)
+
+	return ExitUsage
+}
+
+// newFlagSet returns the flags of command, stored in cfg. usage describes
+// the arguments of command.
+func newFlagSet(command, usage string, cfg *config, stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: polacco %s [flags] %s\n\nflags:\n", command, usage)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&cfg.mode, "mode", "", "number `mode`: float, bigfloat, rational, complex, or a word size such as int64 or uint8 (default float, or the mode of the restored session)")
+	flags.IntVar(&cfg.precision, "precision", -1, "show numbers with `n` decimals; if negative, in full or with the precision of the restored session")
+	flags.Var(&cfg.stack, "stack", "initial `values` of the stack, separated by spaces or commas")
+
+	return flags
+}
+
+// addStateFlags adds the flags of the commands that restore and save
+// sessions.
+func addStateFlags(flags *flag.FlagSet, cfg *config) {
+	path, _ := engine.StatePath()
+	flags.StringVar(&cfg.stateFile, "state", path, "`file` the session is restored from and saved to; empty disables saving")
+	flags.BoolVar(&cfg.clean, "clean", false, "start a clean session instead of restoring the saved one")
+}
+
+// addHistoryFlags adds the flags of the interactive commands that keep a
+// history of the lines typed.
+func addHistoryFlags(flags *flag.FlagSet, cfg *config) {
+	path, _ := history.DefaultPath()
+	flags.StringVar(&cfg.historyFile, "history", path, "`file` the history is kept in and shared with other sessions; empty keeps it in memory")
+	cfg.histControl = histControlValue(history.IgnoreDups)
+	flags.Var(&cfg.histControl, "histcontrol", "lines left out of the history: ignoredups, ignorespace or ignoreboth, as in bash")
+	flags.IntVar(&cfg.histSize, "histsize", history.DefaultMaxSize, "number of lines the history keeps, and its file is trimmed to")
+}
+
+// parse parses args with flags and returns the backend chosen with -mode,
+// or nil if there is none, which leaves the choice to the session.
+func parse(flags *flag.FlagSet, args []string, cfg *config) (rpn.Backend, error) {
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if cfg.mode == "" {
+		return nil, nil
+	}
+	backend, err := rpn.ParseBackend(cfg.mode)
+	if err != nil {
+		fmt.Fprintln(flags.Output(), "error:", err)
+		return nil, err
+	}
+
+	return backend, nil
+}
+
+// helpStatus returns the exit status for an error returned by parse.
+func helpStatus(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+
+	return ExitUsage
+}
+
+func tui(args []string, stderr io.Writer) int {
+	cfg := &config{}
+	flags := newFlagSet("tui", "", cfg, stderr)
+	addStateFlags(flags, cfg)
+	addHistoryFlags(flags, cfg)
+	backend, err := parse(flags, args, cfg)
+	if err != nil {
+		return helpStatus(err)
+	}
+
+	return ui.Main(
+		ui.SetBackend(backend),
+		ui.SetStack(cfg.stack...),
+		ui.SetPrecision(cfg.precision),
+		ui.SetStateFile(cfg.stateFile),
+		ui.SetCleanStart(cfg.clean),
+		ui.SetHistoryFile(cfg.historyFile),
+		ui.SetHistoryMode(history.Mode(cfg.histControl)),
+		ui.SetMaxHistorySize(cfg.histSize),
+	)
+}
+
+func repl(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	cfg := &config{}
+	flags := newFlagSet("repl", "", cfg, stderr)
+	addStateFlags(flags, cfg)
+	addHistoryFlags(flags, cfg)
+	backend, err := parse(flags, args, cfg)
+	if err != nil {
+		return helpStatus(err)
+	}
+
+	s, err := shell.NewSession(
+		shell.SetStdin(stdin),
+		shell.SetStdout(stdout),
+		shell.SetStderr(stderr),
+		shell.SetBackend(backend),
+		shell.SetPrecision(cfg.precision),
+		shell.SetStack(cfg.stack...),
+		shell.SetPrompt("> "),
+		shell.SetStateFile(cfg.stateFile),
+		shell.SetCleanStart(cfg.clean),
+		shell.SetHistoryFile(cfg.historyFile),
+		shell.SetHistoryMode(history.Mode(cfg.histControl)),
+		shell.SetMaxHistorySize(cfg.histSize),
+	)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return ExitUsage
+	}
+	// an interrupt ends the session rather than the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := s.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintln(stderr, "error:", err)
+		return ExitError
+	}
+
+	return ExitOK
+}
+
+func eval(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	cfg := &config{}
+	flags := newFlagSet("eval", "<expr>...", cfg, stderr)
+	flags.BoolVar(&cfg.top, "top", true, "print only the top of the stack")
+	backend, err := parse(flags, args, cfg)
+	if err != nil {
+		return helpStatus(err)
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(stderr, "error: no expression to evaluate")
+		flags.Usage()
+		return ExitUsage
+	}
+
+	s, err := shell.NewSession(
+		shell.SetStdin(stdin),
+		shell.SetStdout(stdout),
+		shell.SetStderr(stderr),
+		shell.SetBackend(backend),
+		shell.SetPrecision(cfg.precision),
+		shell.SetStack(cfg.stack...),
+		shell.SetTopOnly(cfg.top),
+	)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return ExitUsage
+	}
+	if err := s.Eval(strings.Join(flags.Args(), " ")); err != nil {
+		return ExitError
+	}
+
+	return ExitOK
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	cfg := &config{}
+	flags := newFlagSet("run", "[file]...", cfg, stderr)
+	flags.BoolVar(&cfg.top, "top", false, "print only the top of the stack")
+	backend, err := parse(flags, args, cfg)
+	if err != nil {
+		return helpStatus(err)
+	}
+
+	s, err := shell.NewSession(
+		shell.SetStdin(stdin),
+		shell.SetStdout(stdout),
+		shell.SetStderr(stderr),
+		shell.SetBackend(backend),
+		shell.SetPrecision(cfg.precision),
+		shell.SetStack(cfg.stack...),
+		shell.SetTopOnly(cfg.top),
+	)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return ExitUsage
+	}
+	if err := s.Batch(flags.Args()...); err != nil {
+		return ExitError
+	}
+
+	return ExitOK
+}
@@ -0,0 +1,145 @@
+package cli_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/azr4e1/polacco/cli"
+)
+
+func TestRun_RunsCommands(t *testing.T) {
+	t.Parallel()
+	script := filepath.Join(t.TempDir(), "script.rpn")
+	if err := os.WriteFile(script, []byte("# a script\n2 3 *\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	type TestCase struct {
+		Args   []string
+		Stdin  string
+		Output string
+	}
+	testCases := []TestCase{
+		{Args: []string{"--version"}, Output: "polacco " + cli.Version + "\n"},
+		{Args: []string{"eval", "3 4 +"}, Output: "7\n"},
+		{Args: []string{"eval", "1", "2", "3"}, Output: "3\n"},
+		{Args: []string{"eval", "-top=false", "1 2 3"}, Output: "[1 2 3]\n"},
+		{Args: []string{"eval", "-stack", "1,2", "-stack", "3", "+ +"}, Output: "6\n"},
+		{Args: []string{"eval", "-mode", "rational", "1 3 /"}, Output: "1/3\n"},
+		{Args: []string{"eval", "-mode", "rational", "-precision", "2", "1 3 /"}, Output: "0.33\n"},
+		{Args: []string{"eval", "-mode", "complex", "0 1 - sqrt"}, Output: "1i\n"},
+		{Args: []string{"eval", "-mode", "uint8", "255 1 +"}, Output: "0\n"},
+		{Args: []string{"run", script}, Output: "[6]\n"},
+		{Args: []string{"run", "-top", script, "-"}, Stdin: "7 *", Output: "42\n"},
+		{Args: []string{"run"}, Stdin: "1 2", Output: "[1 2]\n"},
+		{Args: []string{"repl", "-state", "", "-history", ""}, Stdin: "1 2 +\nl\n", Output: "> > [3]\n> "},
+	}
+	for _, tc := range testCases {
+		stdout := new(bytes.Buffer)
+		stderr := new(bytes.Buffer)
+		status := cli.Run(tc.Args, strings.NewReader(tc.Stdin), stdout, stderr)
+		if status != cli.ExitOK {
+			t.Errorf("%v: want status %d, got %d: %s", tc.Args, cli.ExitOK, status, stderr)
+		}
+		if got := stdout.String(); tc.Output != got {
+			t.Errorf("%v: want %q, got %q", tc.Args, tc.Output, got)
+		}
+	}
+}
+
+func TestRun_AppliesTheSessionFlagsToTheRestoredSession(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Flags  []string
+		Status int
+		Output string
+		// Saved is the stack listed by the next session
+		Saved string
+	}
+	testCases := []TestCase{
+		{Flags: nil, Status: cli.ExitOK, Output: "> [1/3]\n> ", Saved: "> [1/3]\n> "},
+		{Flags: []string{"-mode", "rational"}, Status: cli.ExitOK, Output: "> [1/3]\n> ", Saved: "> [1/3]\n> "},
+		{Flags: []string{"-precision", "2"}, Status: cli.ExitOK, Output: "> [0.33]\n> ", Saved: "> [0.33]\n> "},
+		{Flags: []string{"-stack", "5"}, Status: cli.ExitOK, Output: "> [1/3 5]\n> ", Saved: "> [1/3 5]\n> "},
+		{Flags: []string{"-mode", "float"}, Status: cli.ExitUsage, Output: "", Saved: "> [1/3]\n> "},
+		{Flags: []string{"-mode", "float", "-clean"}, Status: cli.ExitOK, Output: "> []\n> ", Saved: "> []\n> "},
+	}
+	for _, tc := range testCases {
+		state := filepath.Join(t.TempDir(), "state")
+		repl := func(input string, flags ...string) (int, string, string) {
+			args := append([]string{"repl", "-state", state, "-history", ""}, flags...)
+			stdout := new(bytes.Buffer)
+			stderr := new(bytes.Buffer)
+			status := cli.Run(args, strings.NewReader(input), stdout, stderr)
+			return status, stdout.String(), stderr.String()
+		}
+		if status, _, errs := repl("1 3 /\n", "-mode", "rational"); status != cli.ExitOK {
+			t.Fatalf("want status %d, got %d: %s", cli.ExitOK, status, errs)
+		}
+
+		status, got, errs := repl("l\nq\n", tc.Flags...)
+		if tc.Status != status {
+			t.Errorf("%v: want status %d, got %d: %s", tc.Flags, tc.Status, status, errs)
+		}
+		if tc.Output != got {
+			t.Errorf("%v: want %q, got %q", tc.Flags, tc.Output, got)
+		}
+		if _, got, _ := repl("l\n"); tc.Saved != got {
+			t.Errorf("%v: want %q saved, got %q", tc.Flags, tc.Saved, got)
+		}
+	}
+}
+
+func TestRun_ReturnsErrorStatuses(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Args   []string
+		Status int
+		Error  string
+	}
+	testCases := []TestCase{
+		{Args: []string{"eval", "1 0 /"}, Status: cli.ExitError, Error: "error: /: cannot divide by 0"},
+		{Args: []string{"eval", "drop"}, Status: cli.ExitError, Error: "error: not enough elements"},
+		{Args: []string{"run", "missing.rpn"}, Status: cli.ExitError, Error: "error: open missing.rpn"},
+		{Args: []string{"eval"}, Status: cli.ExitUsage, Error: "error: no expression to evaluate"},
+		{Args: []string{"eval", "-mode", "decimal", "1"}, Status: cli.ExitUsage, Error: "error: unknown backend: decimal"},
+		{Args: []string{"eval", "-stack", "1,x", "1"}, Status: cli.ExitUsage, Error: "invalid number: x"},
+		{Args: []string{"eval", "-mode", "bigfloat", "-stack", "nan", "1 +"}, Status: cli.ExitUsage, Error: "error: big floats cannot hold NaN"},
+		{Args: []string{"eval", "-nope", "1"}, Status: cli.ExitUsage, Error: "flag provided but not defined: -nope"},
+		{Args: []string{"repl", "-histcontrol", "erasedups"}, Status: cli.ExitUsage, Error: "unknown history mode: erasedups"},
+		{Args: []string{"repl", "-histsize", "0"}, Status: cli.ExitUsage, Error: "error: history size must be at least 1"},
+		{Args: []string{"calc"}, Status: cli.ExitUsage, Error: "error: unknown command: calc"},
+	}
+	for _, tc := range testCases {
+		stdout := new(bytes.Buffer)
+		stderr := new(bytes.Buffer)
+		status := cli.Run(tc.Args, strings.NewReader(""), stdout, stderr)
+		if status != tc.Status {
+			t.Errorf("%v: want status %d, got %d", tc.Args, tc.Status, status)
+		}
+		if !strings.Contains(stderr.String(), tc.Error) {
+			t.Errorf("%v: want %q in the errors, got %q", tc.Args, tc.Error, stderr)
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("%v: want no output, got %q", tc.Args, stdout)
+		}
+	}
+}
+
+func TestRun_PrintsHelp(t *testing.T) {
+	t.Parallel()
+	for _, args := range [][]string{{"--help"}, {"-h"}, {"eval", "--help"}, {"run", "-h"}} {
+		stdout := new(bytes.Buffer)
+		stderr := new(bytes.Buffer)
+		status := cli.Run(args, strings.NewReader(""), stdout, stderr)
+		if status != cli.ExitOK {
+			t.Errorf("%v: want status %d, got %d", args, cli.ExitOK, status)
+		}
+		if !strings.HasPrefix(stderr.String(), "usage: polacco") {
+			t.Errorf("%v: want usage, got %q", args, stderr)
+		}
+	}
+}
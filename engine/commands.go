@@ -0,0 +1,311 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/azr4e1/polacco/rpn"
+)
+
+// Command is a command that can be typed instead of an expression, such as
+// pop. Name and Aliases are matched case insensitively against the first
+// word of the line. Commands with an Arg, such as see <name>, take the
+// rest of the line as their argument, and only match when there is one.
+type Command struct {
+	Name    string
+	Aliases []string
+	Arg     string
+	Help    string
+	Run     func(e *Engine, arg string) (string, error)
+}
+
+type commandRegistry struct {
+	mu       sync.RWMutex
+	commands []Command
+}
+
+var commands = &commandRegistry{}
+
+// RegisterCommand adds cmd to the commands of every engine. It is an error
+// to register a name twice.
+func RegisterCommand(cmd Command) error {
+	if cmd.Run == nil {
+		return fmt.Errorf("command %q has no function", cmd.Name)
+	}
+	cmd.Name = strings.ToLower(cmd.Name)
+	cmd.Aliases = append([]string(nil), cmd.Aliases...)
+	for i, alias := range cmd.Aliases {
+		cmd.Aliases[i] = strings.ToLower(alias)
+	}
+
+	commands.mu.Lock()
+	defer commands.mu.Unlock()
+	for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+		if name == "" || strings.IndexFunc(name, unicode.IsSpace) >= 0 {
+			return fmt.Errorf("invalid command name %q", name)
+		}
+		for _, other := range commands.commands {
+			if other.matches(name) {
+				return fmt.Errorf("command %q is already registered", name)
+			}
+		}
+	}
+	commands.commands = append(commands.commands, cmd)
+
+	return nil
+}
+
+// unregisterCommand removes the command called name. Tests use it to leave
+// the registry as they found it.
+func unregisterCommand(name string) {
+	name = strings.ToLower(name)
+	commands.mu.Lock()
+	defer commands.mu.Unlock()
+	for i, cmd := range commands.commands {
+		if cmd.Name == name {
+			commands.commands = append(commands.commands[:i:i], commands.commands[i+1:]...)
+			return
+		}
+	}
+}
+
+// MustRegisterCommand is like RegisterCommand but panics on error.
+func MustRegisterCommand(cmd Command) {
+	if err := RegisterCommand(cmd); err != nil {
+		panic(err)
+	}
+}
+
+// Commands returns every registered command in registration order.
+func Commands() []Command {
+	commands.mu.RLock()
+	defer commands.mu.RUnlock()
+
+	return append([]Command(nil), commands.commands...)
+}
+
+func (c Command) matches(name string) bool {
+	if c.Name == name {
+		return true
+	}
+	for _, alias := range c.Aliases {
+		if alias == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookupCommand returns the command line asks for, and its argument.
+func lookupCommand(line string) (Command, string, bool) {
+	line = strings.TrimSpace(line)
+	name, arg := line, ""
+	if i := strings.IndexFunc(line, unicode.IsSpace); i >= 0 {
+		name, arg = line[:i], strings.TrimSpace(line[i:])
+	}
+	name = strings.ToLower(name)
+
+	commands.mu.RLock()
+	defer commands.mu.RUnlock()
+	for _, cmd := range commands.commands {
+		if cmd.matches(name) && (cmd.Arg != "") == (arg != "") {
+			return cmd, arg, true
+		}
+	}
+
+	return Command{}, "", false
+}
+
+// isCommandName reports whether name is the name or an alias of a
+// command, and so cannot name a variable or a user-defined word.
+func isCommandName(name string) bool {
+	commands.mu.RLock()
+	defer commands.mu.RUnlock()
+	for _, cmd := range commands.commands {
+		if cmd.matches(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Help returns the help of the engine followed by the commands and the
+// operators.
+func (e *Engine) Help() string {
+	lines := []string{e.help, "", "Commands:"}
+	for _, cmd := range Commands() {
+		usage := cmd.Name
+		if len(cmd.Aliases) > 0 {
+			usage += ", " + cmd.Aliases[0]
+		}
+		if cmd.Arg != "" {
+			usage += " " + cmd.Arg
+		}
+		lines = append(lines, fmt.Sprintf("\t%-16s %s", usage, cmd.Help))
+	}
+	lines = append(lines, "", "Supported operations:")
+	for _, op := range rpn.Operators() {
+		lines = append(lines, fmt.Sprintf("\t%-6s %s", op.Name, op.Help))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// setBase builds the command that shows integers in base.
+func setBase(base int) func(*Engine, string) (string, error) {
+	return func(e *Engine, _ string) (string, error) {
+		e.base = base
+		return "", nil
+	}
+}
+
+func init() {
+	for _, cmd := range []Command{
+		{
+			Name:    "help",
+			Aliases: []string{"h", "he", "hel"},
+			Help:    "print this help",
+			Run:     func(e *Engine, _ string) (string, error) { return e.Help(), nil },
+		},
+		{
+			Name:    "quit",
+			Aliases: []string{"q", "qu", "qui"},
+			Help:    "quit",
+			Run:     func(*Engine, string) (string, error) { return "", ErrQuit },
+		},
+		{
+			Name:    "pop",
+			Aliases: []string{"p", "po"},
+			Help:    "pop and show the last element of the stack",
+			Run: func(e *Engine, _ string) (string, error) {
+				var val rpn.Number
+				err := e.journal.Do("pop", func(stack *rpn.RPNStack) error {
+					var err error
+					val, err = stack.PopNumber()
+					return err
+				})
+				if err != nil {
+					return "", err
+				}
+				return e.Format(val), nil
+			},
+		},
+		{
+			Name:    "reset",
+			Aliases: []string{"r", "re", "res", "rese"},
+			Help:    "reset the stack",
+			Run: func(e *Engine, _ string) (string, error) {
+				return "", e.journal.Do("reset", func(stack *rpn.RPNStack) error {
+					stack.Clear()
+					return nil
+				})
+			},
+		},
+		{
+			Name:    "list",
+			Aliases: []string{"l", "ls", "li", "lis"},
+			Help:    "show the stack",
+			Run:     func(e *Engine, _ string) (string, error) { return e.List(), nil },
+		},
+		{
+			Name:    "undo",
+			Aliases: []string{"u", "un", "und"},
+			Help:    "undo the last change to the stack, variables or words",
+			Run: func(e *Engine, _ string) (string, error) {
+				_, err := e.Undo()
+				return "", err
+			},
+		},
+		{
+			Name: "redo",
+			Help: "redo the last undone change",
+			Run: func(e *Engine, _ string) (string, error) {
+				_, err := e.Redo()
+				return "", err
+			},
+		},
+		{Name: "hex", Help: "show integers in base 16 in programmer mode", Run: setBase(16)},
+		{Name: "dec", Help: "show integers in base 10 in programmer mode", Run: setBase(10)},
+		{Name: "oct", Help: "show integers in base 8 in programmer mode", Run: setBase(8)},
+		{Name: "bin", Help: "show integers in base 2 in programmer mode", Run: setBase(2)},
+		{
+			Name: "vars",
+			Help: "show variables and registers",
+			Run: func(e *Engine, _ string) (string, error) {
+				vars := e.stack.Variables()
+				lines := []string{}
+				for _, name := range e.stack.VariableNames() {
+					lines = append(lines, fmt.Sprintf("%s: %s", name, e.Format(vars[name])))
+				}
+				return strings.Join(lines, "\n"), nil
+			},
+		},
+		{
+			Name: "clvars",
+			Help: "clear variables and registers",
+			Run: func(e *Engine, _ string) (string, error) {
+				return "", e.journal.Do("clvars", func(stack *rpn.RPNStack) error {
+					stack.ClearVariables()
+					return nil
+				})
+			},
+		},
+		{
+			Name: "words",
+			Help: "list user-defined words",
+			Run: func(e *Engine, _ string) (string, error) {
+				names := []string{}
+				for _, def := range e.stack.Definitions() {
+					names = append(names, def.Name)
+				}
+				return strings.Join(names, " "), nil
+			},
+		},
+		{
+			Name: "see",
+			Arg:  "<name>",
+			Help: "show the definition of a word",
+			Run: func(e *Engine, name string) (string, error) {
+				def, ok := e.stack.Word(name)
+				if !ok {
+					return "", fmt.Errorf("%s is not defined", name)
+				}
+				return def.String(), nil
+			},
+		},
+		{
+			Name: "forget",
+			Arg:  "<name>",
+			Help: "remove a user-defined word",
+			Run: func(e *Engine, name string) (string, error) {
+				return "", e.journal.Do("forget "+name, func(stack *rpn.RPNStack) error {
+					return stack.Forget(name)
+				})
+			},
+		},
+		{
+			Name: "source",
+			Arg:  "<file>",
+			Help: "run a script, which can span several lines",
+			Run:  func(e *Engine, path string) (string, error) { return "", e.RunFile(path) },
+		},
+		{
+			Name: "save",
+			Arg:  "<file>",
+			Help: "save the stack, variables, words, settings and history",
+			Run:  func(e *Engine, path string) (string, error) { return "", e.SaveFile(path) },
+		},
+		{
+			Name: "load",
+			Arg:  "<file>",
+			Help: "restore a session saved with save",
+			Run:  func(e *Engine, path string) (string, error) { return "", e.LoadFile(path) },
+		},
+	} {
+		MustRegisterCommand(cmd)
+	}
+}
@@ -0,0 +1,342 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/azr4e1/polacco/history"
+	"github.com/azr4e1/polacco/rpn"
+)
+
+// ErrQuit is returned by Exec when the line asks to quit.
+var ErrQuit = errors.New("quit")
+
+// Help introduces the syntax of expressions. The help command prints it
+// before the commands and the operators.
+var Help = `Expressions are evaluated in reverse Polish notation: 3 4 + pushes 7.
+negative numbers: _2, or -2 at the start or after a space: 5 3 -2 pushes -2 and does not subtract, 5 3-2 and 5 3 - 2 do
+definitions: : name ... ; defines a word, 'x sto and x rcl store variables
+control flow: cond if ... else ... then, limit start do ... i ... loop, begin ... cond until
+comments: # or \ to the end of the line, ( ... ) inline`
+
+// Engine owns a stack and runs the commands and expressions typed by the
+// user. Front ends such as the shell and the terminal calculator read a
+// line, pass it to Exec and show the output or the error.
+type Engine struct {
+	stack          *rpn.RPNStack
+	backend        rpn.Backend
+	initialStack   []float64
+	base           int
+	precision      int
+	defaultPrec    int
+	journal        *rpn.Journal
+	undoDepth      int
+	history        []string
+	maxHistorySize int
+	historyPointer int
+	historyMode    history.Mode
+	historyFile    *history.File
+	help           string
+}
+
+type option func(*Engine) error
+
+func New(opts ...option) (*Engine, error) {
+	e := &Engine{
+		backend:        rpn.FloatBackend,
+		base:           10,
+		precision:      -1,
+		defaultPrec:    -1,
+		maxHistorySize: history.DefaultMaxSize,
+		historyMode:    history.IgnoreDups,
+		undoDepth:      rpn.DefaultJournalDepth,
+		help:           Help,
+	}
+
+	for _, o := range opts {
+		err := o(e)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, val := range e.initialStack {
+		if err := rpn.CheckFloat(e.backend, val); err != nil {
+			return nil, err
+		}
+	}
+	e.stack = rpn.NewStackWithBackend(e.backend, e.initialStack...)
+	e.stack.SetReserved(isCommandName)
+	e.journal = rpn.NewJournal(e.stack, e.undoDepth)
+	if e.historyFile != nil {
+		e.historyFile.MaxSize = e.maxHistorySize
+		e.historyFile.Mode = e.historyMode
+		lines, err := e.historyFile.Load()
+		if err != nil {
+			return nil, err
+		}
+		e.history = lines
+		e.historyPointer = len(e.history)
+	}
+
+	return e, nil
+}
+
+func SetStack(vals ...float64) option {
+	return func(e *Engine) error {
+		e.initialStack = vals
+		return nil
+	}
+}
+
+func SetBackend(backend rpn.Backend) option {
+	return func(e *Engine) error {
+		if backend == nil {
+			return errors.New("backend is nil")
+		}
+
+		e.backend = backend
+		return nil
+	}
+}
+
+func SetBase(base int) option {
+	return func(e *Engine) error {
+		switch base {
+		case 2, 8, 10, 16:
+		default:
+			return fmt.Errorf("unsupported base: %d", base)
+		}
+
+		e.base = base
+		return nil
+	}
+}
+
+// SetPrecision sets how many decimals numbers are formatted with; a
+// negative precision leaves it unset, and numbers are formatted with the
+// default precision. Only a precision that is set is saved.
+func SetPrecision(decimals int) option {
+	return func(e *Engine) error {
+		e.precision = decimals
+		return nil
+	}
+}
+
+// SetDefaultPrecision sets the precision used when none is set, such as
+// the 6 decimals of the terminal calculator. A negative precision, the
+// default, formats numbers in full.
+func SetDefaultPrecision(decimals int) option {
+	return func(e *Engine) error {
+		e.defaultPrec = decimals
+		return nil
+	}
+}
+
+func SetUndoDepth(undoDepth int) option {
+	return func(e *Engine) error {
+		if undoDepth < 0 {
+			return errors.New("cannot set negative undo depth")
+		}
+
+		e.undoDepth = undoDepth
+		return nil
+	}
+}
+
+// SetMaxHistorySize sets how many lines the history keeps, and the history
+// file is trimmed to. The default is history.DefaultMaxSize; the size must
+// be at least 1.
+func SetMaxHistorySize(maxHistorySize int) option {
+	return func(e *Engine) error {
+		if maxHistorySize < 1 {
+			return errors.New("history size must be at least 1")
+		}
+
+		e.maxHistorySize = maxHistorySize
+		return nil
+	}
+}
+
+// SetHistoryFile keeps the history in the file at path, which is loaded by
+// New and appended to by Exec. Several engines, in the same process or
+// not, can share a file. An empty path keeps the history in memory only.
+func SetHistoryFile(path string) option {
+	return func(e *Engine) error {
+		e.historyFile = nil
+		if path != "" {
+			e.historyFile = &history.File{Path: path}
+		}
+		return nil
+	}
+}
+
+// SetHistoryMode sets which lines are left out of the history. The
+// default is history.IgnoreDups.
+func SetHistoryMode(mode history.Mode) option {
+	return func(e *Engine) error {
+		e.historyMode = mode
+		return nil
+	}
+}
+
+func SetHelp(help string) option {
+	return func(e *Engine) error {
+		e.help = help
+		return nil
+	}
+}
+
+func (e *Engine) Stack() *rpn.RPNStack {
+	return e.stack
+}
+
+func (e *Engine) Base() int {
+	return e.base
+}
+
+// Precision returns how many decimals numbers are formatted with: the
+// precision set, or else the default one.
+func (e *Engine) Precision() int {
+	if e.precision < 0 {
+		return e.defaultPrec
+	}
+
+	return e.precision
+}
+
+// Format formats val in the base and with the precision of the engine.
+func (e *Engine) Format(val rpn.Number) string {
+	return rpn.FormatDecimals(e.backend, val, e.Precision(), e.base)
+}
+
+// List formats the stack as [1 2 3].
+func (e *Engine) List() string {
+	vals := []string{}
+	for _, val := range e.stack.GetNumbers() {
+		vals = append(vals, e.Format(val))
+	}
+
+	return fmt.Sprintf("[%s]", strings.Join(vals, " "))
+}
+
+// Exec records line in the history and runs it: as a command if it names
+// one, and as an expression otherwise. It returns the output to show,
+// which can span several lines and is empty for most expressions, and the
+// error to show. Evaluation errors refer to line, except for those of
+// scripts, which are returned as a *ScriptError.
+func (e *Engine) Exec(line string) (string, error) {
+	e.updateHistory(line)
+
+	if cmd, arg, ok := lookupCommand(line); ok {
+		return cmd.Run(e, arg)
+	}
+
+	return "", e.Eval(strings.TrimSpace(line))
+}
+
+// Eval evaluates expr. Evaluation is atomic, so a failing expression
+// leaves the stack as it was.
+func (e *Engine) Eval(expr string) error {
+	return e.journal.Eval(expr)
+}
+
+// ScriptError is an error in a script, which reports the position of the
+// failing token in Source.
+type ScriptError struct {
+	Name   string
+	Source string
+	Err    error
+}
+
+func (e *ScriptError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// RunScript evaluates the whole of r as a single expression, so a script
+// can span several lines and contain comments. Like Eval, it leaves the
+// stack as it was if the script fails; evaluation errors are returned as a
+// *ScriptError for the script called name.
+func (e *Engine) RunScript(name string, r io.Reader) error {
+	script, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	err = e.journal.Eval(string(script))
+	if err != nil {
+		return &ScriptError{Name: name, Source: string(script), Err: err}
+	}
+
+	return nil
+}
+
+// RunFile runs the script in the file at path with RunScript.
+func (e *Engine) RunFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return e.RunScript(path, f)
+}
+
+// Undo undoes the last change to the stack, variables or words and returns
+// the expression that made it.
+func (e *Engine) Undo() (string, error) {
+	entry, err := e.journal.Undo()
+	return entry.Expression, err
+}
+
+// Redo redoes the last undone change and returns the expression that made
+// it.
+func (e *Engine) Redo() (string, error) {
+	entry, err := e.journal.Redo()
+	return entry.Expression, err
+}
+
+func (e *Engine) History() []string {
+	return e.history
+}
+
+func (e *Engine) updateHistory(line string) {
+	prev := ""
+	if len(e.history) > 0 {
+		prev = e.history[len(e.history)-1]
+	}
+	if e.historyMode.Ignore(line, prev) {
+		return
+	}
+	if e.historyFile != nil {
+		// a failed write only loses the line for later sessions
+		e.historyFile.Append(line) //nolint:errcheck
+	}
+	e.history = append(e.history, line)
+	e.history = e.history[max(0, len(e.history)-e.maxHistorySize):len(e.history)]
+	e.historyPointer = len(e.history) // reset pointer to last element
+}
+
+func (e *Engine) PrevHistory() (string, error) {
+	if e.historyPointer <= 0 {
+		e.historyPointer = 0
+		return "", errors.New("earliest point in history")
+	}
+	e.historyPointer--
+	return e.history[e.historyPointer], nil
+}
+
+func (e *Engine) NextHistory() (string, error) {
+	if e.historyPointer >= len(e.history)-1 {
+		e.historyPointer = len(e.history) - 1
+		return "", errors.New("latest point in history")
+	}
+	e.historyPointer++
+	return e.history[e.historyPointer], nil
+}
@@ -0,0 +1,288 @@
+package engine_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/azr4e1/polacco/engine"
+	"github.com/azr4e1/polacco/history"
+	"github.com/azr4e1/polacco/rpn"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEngineExec_RunsCommandsAndExpressions(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Lines  []string
+		Output string
+	}
+	testCases := []TestCase{
+		{Lines: []string{"1 2 +", "ls"}, Output: "[3]"},
+		{Lines: []string{"1 2 +", "  LIST  "}, Output: "[3]"},
+		{Lines: []string{"1 2", "pop"}, Output: "2"},
+		{Lines: []string{"1 2", "r", "l"}, Output: "[]"},
+		{Lines: []string{"1 2", "reset", "undo", "l"}, Output: "[1 2]"},
+		{Lines: []string{"1 2", "reset", "undo", "redo", "l"}, Output: "[]"},
+		{Lines: []string{"2 'x sto", "7 3 sto", "vars"}, Output: "3: 7\nx: 2"},
+		{Lines: []string{"2 'x sto", "clvars", "vars"}, Output: ""},
+		{Lines: []string{": sq dup * ;", ": cube dup sq * ;", "words"}, Output: "cube sq"},
+		{Lines: []string{": sq dup * ;", "see SQ"}, Output: ": sq dup * ;"},
+		{Lines: []string{": sq dup * ;", "forget sq", "words"}, Output: ""},
+		{Lines: []string{": sq dup * ;", "forget sq", "undo", "words"}, Output: "sq"},
+		{Lines: []string{": sq dup * ;", ": cube dup sq * ;", "undo", "words"}, Output: "sq"},
+	}
+	for _, tc := range testCases {
+		e, err := engine.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got string
+		for _, line := range tc.Lines {
+			got, err = e.Exec(line)
+			if err != nil {
+				t.Fatalf("%q: %v", line, err)
+			}
+		}
+		if tc.Output != got {
+			t.Errorf("%q: want %q, got %q", tc.Lines, tc.Output, got)
+		}
+	}
+}
+
+func TestEngineExec_ReturnsErrors(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Line  string
+		Error string
+	}
+	testCases := []TestCase{
+		{Line: "pop", Error: "not enough elements in the stack: pop needs 1, have 0"},
+		{Line: "undo", Error: "nothing to undo"},
+		{Line: "see sq", Error: "sq is not defined"},
+		{Line: "forget sq", Error: "sq is not defined"},
+		{Line: "1 0 /", Error: "/: cannot divide by 0"},
+		{Line: "see", Error: `unknown word "see" at offset 0`},
+		{Line: "7 'r sto", Error: `sto: "r" is a reserved name`},
+		{Line: ": hex 16 ;", Error: `"hex" is a reserved name`},
+	}
+	for _, tc := range testCases {
+		e, err := engine.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = e.Exec(tc.Line)
+		if err == nil {
+			t.Fatalf("%q: want error, got nil", tc.Line)
+		}
+		if err.Error() != tc.Error {
+			t.Errorf("%q: want %s, got %s", tc.Line, tc.Error, err)
+		}
+	}
+}
+
+func TestEngineExec_ReturnsErrQuit(t *testing.T) {
+	t.Parallel()
+	e, err := engine.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"q", "qui", "Quit"} {
+		if _, err := e.Exec(line); !errors.Is(err, engine.ErrQuit) {
+			t.Errorf("%q: want ErrQuit, got %v", line, err)
+		}
+	}
+}
+
+func TestEngineExec_FormatsWithTheBaseAndPrecision(t *testing.T) {
+	t.Parallel()
+	programmer, err := rpn.NewIntegerBackend(16, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type TestCase struct {
+		Engine func() (*engine.Engine, error)
+		Lines  []string
+		Output string
+	}
+	testCases := []TestCase{
+		{
+			Engine: func() (*engine.Engine, error) { return engine.New(engine.SetPrecision(3)) },
+			Lines:  []string{"2 3 /", "l"},
+			Output: "[0.667]",
+		},
+		{
+			Engine: func() (*engine.Engine, error) { return engine.New(engine.SetStack(1, 2.5)) },
+			Lines:  []string{"l"},
+			Output: "[1 2.5]",
+		},
+		{
+			Engine: func() (*engine.Engine, error) { return engine.New(engine.SetBackend(programmer)) },
+			Lines:  []string{"255", "hex", "l"},
+			Output: "[0xFF]",
+		},
+		{
+			Engine: func() (*engine.Engine, error) {
+				return engine.New(engine.SetBackend(programmer), engine.SetBase(2))
+			},
+			Lines:  []string{"5", "pop"},
+			Output: "0b101",
+		},
+	}
+	for _, tc := range testCases {
+		e, err := tc.Engine()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got string
+		for _, line := range tc.Lines {
+			got, err = e.Exec(line)
+			if err != nil {
+				t.Fatalf("%q: %v", line, err)
+			}
+		}
+		if tc.Output != got {
+			t.Errorf("%q: want %q, got %q", tc.Lines, tc.Output, got)
+		}
+	}
+}
+
+func TestEngineExec_ReturnsScriptErrorsForSourcedFiles(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "script.rpn")
+	if err := os.WriteFile(path, []byte("1 2\n+ +\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := engine.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = e.Exec("source " + path)
+	var scriptErr *engine.ScriptError
+	if !errors.As(err, &scriptErr) {
+		t.Fatalf("want a *ScriptError, got %v", err)
+	}
+	if scriptErr.Name != path || scriptErr.Source != "1 2\n+ +\n" {
+		t.Errorf("want the script %s, got %s: %q", path, scriptErr.Name, scriptErr.Source)
+	}
+	token, offset, ok := rpn.ErrorToken(err)
+	if !ok || token != "+" || offset != 6 {
+		t.Errorf("want + at offset 6, got %q at offset %d", token, offset)
+	}
+	if got := e.List(); got != "[]" {
+		t.Errorf("want the stack untouched, got %s", got)
+	}
+}
+
+func TestEngineExec_RecordsHistory(t *testing.T) {
+	t.Parallel()
+	e, err := engine.New(engine.SetMaxHistorySize(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"1", "2", "  ", "2", "ls", "pop", "1 0 /"} {
+		_, _ = e.Exec(line)
+	}
+	want := []string{"ls", "pop", "1 0 /"}
+	if got := e.History(); !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+	prev, err := e.PrevHistory()
+	if err != nil || prev != "1 0 /" {
+		t.Errorf("want 1 0 /, got %q, %v", prev, err)
+	}
+}
+
+func TestRegisterCommand_AddsCommandsToEveryEngine(t *testing.T) {
+	t.Parallel()
+	err := engine.RegisterCommand(engine.Command{
+		Name:    "Size",
+		Aliases: []string{"sz"},
+		Help:    "show how many elements the stack holds",
+		Run: func(e *engine.Engine, _ string) (string, error) {
+			return strings.Repeat("*", e.Stack().Depth()), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { engine.UnregisterCommand("size") })
+	e, err := engine.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.Exec("1 2 3"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := e.Exec("SZ")
+	if err != nil || got != "***" {
+		t.Errorf("want ***, got %q, %v", got, err)
+	}
+	if help := e.Help(); !strings.Contains(help, "size, sz") {
+		t.Errorf("want the command in the help, got %s", help)
+	}
+}
+
+func TestRegisterCommand_ReturnsErrorForInvalidCommands(t *testing.T) {
+	t.Parallel()
+	run := func(*engine.Engine, string) (string, error) { return "", nil }
+	testCases := []engine.Command{
+		{Name: "pop", Run: run},
+		{Name: "popall", Aliases: []string{"P"}, Run: run},
+		{Name: "", Run: run},
+		{Name: "two words", Run: run},
+		{Name: "nothing"},
+	}
+	for _, cmd := range testCases {
+		if err := engine.RegisterCommand(cmd); err == nil {
+			t.Errorf("%q: want error, got nil", cmd.Name)
+		}
+	}
+}
+
+func TestEngineNew_RejectsHistorySizesBelowOne(t *testing.T) {
+	t.Parallel()
+	// a history file with a size of 0 would never be trimmed
+	for _, size := range []int{-1, 0} {
+		if _, err := engine.New(engine.SetMaxHistorySize(size)); err == nil {
+			t.Errorf("%d: want error, got nil", size)
+		}
+	}
+}
+
+func TestEngineExec_SharesHistoryFile(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "history")
+	first, err := engine.New(engine.SetHistoryFile(path), engine.SetMaxHistorySize(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := engine.New(engine.SetHistoryFile(path), engine.SetHistoryMode(history.IgnoreBoth))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"1", "2", "2", "3"} {
+		_, _ = first.Exec(line)
+	}
+	for _, line := range []string{"3", " 4", "5"} {
+		_, _ = second.Exec(line)
+	}
+	third, err := engine.New(engine.SetHistoryFile(path), engine.SetMaxHistorySize(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2", "3", "5"}
+	if got := third.History(); !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
@@ -0,0 +1,3 @@
+package engine
+
+var UnregisterCommand = unregisterCommand
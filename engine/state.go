@@ -0,0 +1,227 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/azr4e1/polacco/rpn"
+)
+
+// StateVersion is the version of the state files written by Save.
+const StateVersion = 1
+
+// state is what Save writes: everything needed to carry on a session
+// after a restart. Numbers are written with rpn.MarshalNumber.
+type state struct {
+	Version   int               `json:"version"`
+	Mode      string            `json:"mode"`
+	Bits      uint              `json:"bits,omitempty"` // of the bigfloat mode
+	Base      int               `json:"base"`
+	Precision *int              `json:"precision,omitempty"` // if set by the user
+	Stack     []string          `json:"stack"`
+	Variables map[string]string `json:"variables,omitempty"`
+	Words     []word            `json:"words,omitempty"`
+	History   []string          `json:"history,omitempty"`
+}
+
+type word struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+// StatePath returns the file sessions are saved to between launches:
+// polacco/state.json in $XDG_STATE_HOME, or in ~/.local/state if it is not
+// set.
+func StatePath() (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if !filepath.IsAbs(dir) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+
+	return filepath.Join(dir, "polacco", "state.json"), nil
+}
+
+// Save writes the stack, variables, user-defined words, display settings
+// and history of the engine to w.
+func (e *Engine) Save(w io.Writer) error {
+	st := state{
+		Version: StateVersion,
+		Mode:    e.backend.Name(),
+		Base:    e.base,
+		Stack:   []string{},
+		History: e.history,
+	}
+	st.Bits, _ = rpn.BigFloatPrecision(e.backend)
+	if e.precision >= 0 {
+		st.Precision = &e.precision
+	}
+	for _, val := range e.stack.GetNumbers() {
+		st.Stack = append(st.Stack, rpn.MarshalNumber(e.backend, val))
+	}
+	vars := e.stack.Variables()
+	if len(vars) > 0 {
+		st.Variables = map[string]string{}
+	}
+	for name, val := range vars {
+		st.Variables[name] = rpn.MarshalNumber(e.backend, val)
+	}
+	for _, def := range e.stack.Definitions() {
+		st.Words = append(st.Words, word{Name: def.Name, Source: def.Source})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(st)
+}
+
+// Load replaces the state of the engine, including its number mode, with
+// the one Save wrote to r. The undo history starts afresh, and the history
+// of lines is kept if the engine has a history file. If r cannot be
+// read, the engine is left as it was.
+func (e *Engine) Load(r io.Reader) error {
+	var st state
+	if err := json.NewDecoder(r).Decode(&st); err != nil {
+		return fmt.Errorf("invalid state: %w", err)
+	}
+	if st.Version != StateVersion {
+		return fmt.Errorf("unsupported state version: %d", st.Version)
+	}
+	switch st.Base {
+	case 2, 8, 10, 16:
+	default:
+		return fmt.Errorf("unsupported base: %d", st.Base)
+	}
+	backend, err := rpn.ParseBackend(st.Mode)
+	if err != nil {
+		return err
+	}
+	if _, ok := rpn.BigFloatPrecision(backend); ok && st.Bits != 0 {
+		if backend, err = rpn.NewBigFloatBackend(st.Bits); err != nil {
+			return err
+		}
+	}
+	precision := -1
+	if st.Precision != nil {
+		precision = *st.Precision
+	}
+
+	stack := rpn.NewStackWithBackend(backend)
+	for _, text := range st.Stack {
+		val, err := rpn.UnmarshalNumber(backend, text)
+		if err != nil {
+			return fmt.Errorf("invalid number in state: %s", text)
+		}
+		stack.PushNumber(val)
+	}
+	for name, text := range st.Variables {
+		val, err := rpn.UnmarshalNumber(backend, text)
+		if err != nil {
+			return fmt.Errorf("invalid number in state: %s", text)
+		}
+		if err := stack.SetVariable(name, val); err != nil {
+			return err
+		}
+	}
+	for _, w := range st.Words {
+		if err := stack.Define(w.Name, w.Source); err != nil {
+			// %v drops the position, which is in the source of the word
+			// rather than in the line that loaded it
+			return fmt.Errorf("cannot define %s: %v", w.Name, err)
+		}
+	}
+
+	e.backend, e.base, e.precision = backend, st.Base, precision
+	// saved variables and words that clash with commands still load, but
+	// new ones cannot be made
+	stack.SetReserved(isCommandName)
+	e.stack = stack
+	e.journal = rpn.NewJournal(stack, e.undoDepth)
+	// a history file is shared with other sessions and takes precedence
+	if e.historyFile == nil {
+		e.history = st.History[max(0, len(st.History)-e.maxHistorySize):]
+		e.historyPointer = len(e.history)
+	}
+
+	return nil
+}
+
+// ApplySettings applies the settings a front end was started with on top
+// of a loaded state: a precision of 0 or more replaces the saved one, and
+// the values of stack are pushed on the saved stack. The saved numbers
+// cannot change mode, so a backend other than nil and the saved one is an
+// error.
+func (e *Engine) ApplySettings(backend rpn.Backend, precision int, stack []float64) error {
+	if backend != nil && modeName(backend) != modeName(e.backend) {
+		return fmt.Errorf("the saved session is in %s mode, not %s: start a clean session to change it", modeName(e.backend), modeName(backend))
+	}
+	for _, val := range stack {
+		if err := rpn.CheckFloat(e.backend, val); err != nil {
+			return err
+		}
+	}
+	if precision >= 0 {
+		e.precision = precision
+	}
+	for _, val := range stack {
+		e.stack.Push(val)
+	}
+
+	return nil
+}
+
+// modeName returns the name of the backend b, with the precision of big
+// floats: bigfloat (256 bits).
+func modeName(b rpn.Backend) string {
+	if bits, ok := rpn.BigFloatPrecision(b); ok {
+		return fmt.Sprintf("%s (%d bits)", b.Name(), bits)
+	}
+
+	return b.Name()
+}
+
+// SaveFile saves the engine to the file at path with Save, creating its
+// directory if needed. The file is replaced atomically, so a failed save
+// leaves the previous one intact.
+func (e *Engine) SaveFile(path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := e.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// LoadFile loads the engine from the file at path with Load.
+func (e *Engine) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := e.Load(f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,274 @@
+package engine_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/azr4e1/polacco/engine"
+	"github.com/azr4e1/polacco/rpn"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEngineSave_IsRestoredByLoad(t *testing.T) {
+	t.Parallel()
+	e, err := engine.New(engine.SetBackend(rpn.RationalBackend))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{": sq dup * ;", "3 sq 'x sto", "1 3 / 5 4 sto", "2 sqrt", "hex"} {
+		if _, err := e.Exec(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := e.Save(buf); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := engine.New(engine.SetPrecision(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Load(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := restored.Stack().Backend().Name(); got != "rational" {
+		t.Errorf("want the rational backend, got %s", got)
+	}
+	if want, got := e.List(), restored.List(); want != got {
+		t.Errorf("want stack %s, got %s", want, got)
+	}
+	wantVars, _ := e.Exec("vars")
+	if gotVars, _ := restored.Exec("vars"); wantVars != gotVars {
+		t.Errorf("want variables %q, got %q", wantVars, gotVars)
+	}
+	if want, got := e.Stack().Definitions(), restored.Stack().Definitions(); !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+	if want, got := e.History(), restored.History(); !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+	if restored.Base() != 16 || restored.Precision() != -1 {
+		t.Errorf("want base 16 and precision -1, got %d and %d", restored.Base(), restored.Precision())
+	}
+	if _, err := restored.Exec("2 sq"); err != nil {
+		t.Errorf("want restored words to run, got %v", err)
+	}
+	if _, err := restored.Exec("undo"); err != nil {
+		t.Errorf("want the restored engine to record changes, got %v", err)
+	}
+	if _, err := restored.Exec("undo"); err == nil {
+		t.Error("want the undo history to start afresh, got nil")
+	}
+}
+
+func TestEngineSave_KeepsTheModeAndOnlyTheSetPrecision(t *testing.T) {
+	t.Parallel()
+	bigFloat, err := rpn.NewBigFloatBackend(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type TestCase struct {
+		Engine    func() (*engine.Engine, error)
+		List      string
+		Precision int
+		Bits      uint
+	}
+	testCases := []TestCase{
+		{
+			Engine:    func() (*engine.Engine, error) { return engine.New(engine.SetDefaultPrecision(6)) },
+			List:      "[7]",
+			Precision: -1,
+		},
+		{
+			Engine:    func() (*engine.Engine, error) { return engine.New(engine.SetPrecision(2)) },
+			List:      "[7.00]",
+			Precision: 2,
+		},
+		{
+			Engine:    func() (*engine.Engine, error) { return engine.New(engine.SetBackend(bigFloat)) },
+			List:      "[7]",
+			Precision: -1,
+			Bits:      100,
+		},
+	}
+	for i, tc := range testCases {
+		e, err := tc.Engine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.Exec("7"); err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		if err := e.Save(buf); err != nil {
+			t.Fatal(err)
+		}
+
+		restored, err := engine.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := restored.Load(buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := restored.List(); tc.List != got {
+			t.Errorf("%d: want %s, got %s", i, tc.List, got)
+		}
+		if got := restored.Precision(); tc.Precision != got {
+			t.Errorf("%d: want precision %d, got %d", i, tc.Precision, got)
+		}
+		if got, _ := rpn.BigFloatPrecision(restored.Stack().Backend()); tc.Bits != got {
+			t.Errorf("%d: want %d bits, got %d", i, tc.Bits, got)
+		}
+	}
+}
+
+func TestEngineLoad_KeepsTheHistoryFile(t *testing.T) {
+	t.Parallel()
+	saved, err := engine.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := saved.Exec("1 2"); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := saved.Save(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := engine.New(engine.SetHistoryFile(filepath.Join(t.TempDir(), "history")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Exec("3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Load(buf); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := []string{"3"}, e.History(); !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+	if want, got := "[1 2]", e.List(); want != got {
+		t.Errorf("want stack %s, got %s", want, got)
+	}
+}
+
+func TestEngineLoad_LeavesTheEngineUntouchedOnError(t *testing.T) {
+	t.Parallel()
+	testCases := []string{
+		``,
+		`{"version": 2, "mode": "float", "base": 10}`,
+		`{"version": 1, "mode": "decimal", "base": 10}`,
+		`{"version": 1, "mode": "float", "base": 3}`,
+		`{"version": 1, "mode": "float", "base": 10, "stack": ["1", "x"]}`,
+		`{"version": 1, "mode": "float", "base": 10, "variables": {"+": "1"}}`,
+		`{"version": 1, "mode": "float", "base": 10, "words": [{"name": "sq", "source": "dup *"}, {"name": "dup", "source": "1"}]}`,
+	}
+	for _, tc := range testCases {
+		e, err := engine.New(engine.SetStack(1, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := e.Load(strings.NewReader(tc)); err == nil {
+			t.Errorf("%s: want error, got nil", tc)
+		}
+		if got := e.List(); got != "[1 2]" {
+			t.Errorf("%s: want the stack untouched, got %s", tc, got)
+		}
+		if len(e.Stack().Definitions()) != 0 {
+			t.Errorf("%s: want no words, got %v", tc, e.Stack().Definitions())
+		}
+	}
+}
+
+func TestEngineLoad_DropsThePositionOfErrorsInWords(t *testing.T) {
+	t.Parallel()
+	e, err := engine.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = e.Load(strings.NewReader(`{"version": 1, "mode": "float", "base": 10, "words": [{"name": "w", "source": "1 2 1.2.3"}]}`))
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+	if token, offset, ok := rpn.ErrorToken(err); ok {
+		t.Errorf("want no position, got %q at offset %d", token, offset)
+	}
+}
+
+func TestEngineApplySettings_AppliesThemOnTopOfTheState(t *testing.T) {
+	t.Parallel()
+	e, err := engine.New(engine.SetBackend(rpn.RationalBackend), engine.SetStack(1, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.ApplySettings(nil, 2, []float64{0.5}); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "[1.00 2.00 0.50]", e.List(); want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+	if err := e.ApplySettings(rpn.FloatBackend, -1, nil); err == nil {
+		t.Error("want error for another mode, got nil")
+	}
+	if want, got := 2, e.Precision(); want != got {
+		t.Errorf("want precision %d kept, got %d", want, got)
+	}
+}
+
+func TestEngineExec_SavesAndLoadsFiles(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "nested", "session.json")
+	e, err := engine.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"1 2 3", "save " + path, "reset", "4", "load " + path} {
+		if _, err := e.Exec(line); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+	}
+	if got := e.List(); got != "[1 2 3]" {
+		t.Errorf("want [1 2 3], got %s", got)
+	}
+	want := []string{"1 2 3", "save " + path}
+	if got := e.History(); !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+	if _, err := e.Exec("load " + path + ".missing"); err == nil {
+		t.Error("want error for a missing file, got nil")
+	}
+}
+
+func TestStatePath_UsesXDGStateHome(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", dir)
+	got, err := engine.StatePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "polacco", "state.json"); want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	// relative paths are ignored, as the specification requires
+	t.Setenv("XDG_STATE_HOME", "state")
+	t.Setenv("HOME", dir)
+	got, err = engine.StatePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, ".local", "state", "polacco", "state.json"); want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,211 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Mode controls which lines are recorded, like HISTCONTROL in bash.
+type Mode int
+
+const (
+	// IgnoreDups skips lines equal to the previous one.
+	IgnoreDups Mode = 1 << iota
+	// IgnoreSpace skips lines that start with a space, so that a line can
+	// be kept out of the history on purpose.
+	IgnoreSpace
+	IgnoreBoth = IgnoreDups | IgnoreSpace
+)
+
+// ParseMode parses a mode written as in HISTCONTROL: ignoredups,
+// ignorespace, ignoreboth, or a comma-separated list of them. An empty
+// string records every line.
+func ParseMode(text string) (Mode, error) {
+	var mode Mode
+	for _, name := range strings.Split(text, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+		case "ignoredups":
+			mode |= IgnoreDups
+		case "ignorespace":
+			mode |= IgnoreSpace
+		case "ignoreboth":
+			mode |= IgnoreBoth
+		default:
+			return 0, fmt.Errorf("unknown history mode: %s", name)
+		}
+	}
+
+	return mode, nil
+}
+
+func (m Mode) String() string {
+	switch m {
+	case 0:
+		return ""
+	case IgnoreDups:
+		return "ignoredups"
+	case IgnoreSpace:
+		return "ignorespace"
+	case IgnoreBoth:
+		return "ignoreboth"
+	}
+
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// DefaultMaxSize is the number of entries the shell and the terminal
+// calculator keep, in memory and in the history file they share. Both
+// trim the file when they append to it, so they must agree on its size.
+const DefaultMaxSize = 100
+
+// DefaultPath returns ~/.polacco_history, the history file of the shell and
+// the terminal calculator.
+func DefaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".polacco_history"), nil
+}
+
+// Ignore reports whether line should be left out of a history whose last
+// entry is prev. Blank lines are always left out.
+func (m Mode) Ignore(line, prev string) bool {
+	switch {
+	case strings.TrimSpace(line) == "":
+		return true
+	case m&IgnoreSpace != 0 && strings.HasPrefix(line, " "):
+		return true
+	case m&IgnoreDups != 0 && line == prev:
+		return true
+	}
+
+	return false
+}
+
+// File is a history file with one entry per line, oldest first. Several
+// processes can append to the same file at once: every change is made
+// under a lock on the file.
+type File struct {
+	Path string
+	// MaxSize is the number of entries the file is trimmed to; 0 or less
+	// keeps every entry.
+	MaxSize int
+	Mode    Mode
+}
+
+// Load returns the entries of the file, at most MaxSize of them. A file
+// that does not exist yet has no entries.
+func (f *File) Load() ([]string, error) {
+	file, err := os.Open(f.Path)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if err := lock(file, false); err != nil {
+		return nil, err
+	}
+	defer unlock(file)
+
+	lines, err := readLines(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.trim(lines), nil
+}
+
+// Append adds line to the file unless Mode ignores it, comparing it with
+// the last entry in the file, which may have been written by another
+// process. The file is then trimmed to MaxSize entries. It reports whether
+// line was added.
+func (f *File) Append(line string) (bool, error) {
+	// an entry is a single line
+	line = strings.NewReplacer("\r", " ", "\n", " ").Replace(line)
+
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o700); err != nil {
+		return false, err
+	}
+	file, err := os.OpenFile(f.Path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	if err := lock(file, true); err != nil {
+		return false, err
+	}
+	defer unlock(file)
+
+	lines, err := readLines(file)
+	if err != nil {
+		return false, err
+	}
+	prev := ""
+	if len(lines) > 0 {
+		prev = lines[len(lines)-1]
+	}
+	if f.Mode.Ignore(line, prev) {
+		return false, nil
+	}
+
+	lines = append(lines, line)
+	if trimmed := f.trim(lines); len(trimmed) < len(lines) {
+		return true, rewrite(file, trimmed)
+	}
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		return false, err
+	}
+	_, err = file.WriteString(line + "\n")
+
+	return err == nil, err
+}
+
+func (f *File) trim(lines []string) []string {
+	if f.MaxSize <= 0 {
+		return lines
+	}
+
+	return lines[max(0, len(lines)-f.MaxSize):]
+}
+
+func readLines(file *os.File) ([]string, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	lines := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	return lines, scanner.Err()
+}
+
+// rewrite replaces the content of file with lines. It is done in place
+// rather than by renaming a new file, so that the lock held by the caller
+// keeps covering it.
+func rewrite(file *os.File, lines []string) error {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := file.WriteAt(buf.Bytes(), 0)
+
+	return err
+}
@@ -0,0 +1,111 @@
+package history_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/azr4e1/polacco/history"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseMode_ParsesHistControl(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Text string
+		Mode history.Mode
+	}
+	testCases := []TestCase{
+		{Text: "", Mode: 0},
+		{Text: "ignoredups", Mode: history.IgnoreDups},
+		{Text: "ignorespace", Mode: history.IgnoreSpace},
+		{Text: "ignoreboth", Mode: history.IgnoreBoth},
+		{Text: "ignorespace, IgnoreDups", Mode: history.IgnoreBoth},
+	}
+	for _, tc := range testCases {
+		got, err := history.ParseMode(tc.Text)
+		if err != nil {
+			t.Errorf("%q: %v", tc.Text, err)
+		}
+		if got != tc.Mode {
+			t.Errorf("%q: want %v, got %v", tc.Text, tc.Mode, got)
+		}
+	}
+	if _, err := history.ParseMode("erasedups"); err == nil {
+		t.Error("want error for erasedups, got nil")
+	}
+}
+
+func TestFileAppend_IgnoresLinesAndTrims(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Mode history.Mode
+		Want []string
+	}
+	lines := []string{"1", "1", " 2", "", "3", "3"}
+	testCases := []TestCase{
+		{Mode: 0, Want: []string{" 2", "3", "3"}},
+		{Mode: history.IgnoreDups, Want: []string{"1", " 2", "3"}},
+		{Mode: history.IgnoreSpace, Want: []string{"1", "3", "3"}},
+		{Mode: history.IgnoreBoth, Want: []string{"1", "3"}},
+	}
+	for _, tc := range testCases {
+		f := &history.File{Path: filepath.Join(t.TempDir(), "history"), MaxSize: 3, Mode: tc.Mode}
+		for _, line := range lines {
+			if _, err := f.Append(line); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := f.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cmp.Equal(tc.Want, got) {
+			t.Errorf("%v: %s", tc.Mode, cmp.Diff(tc.Want, got))
+		}
+	}
+}
+
+func TestFileLoad_ReturnsNoEntriesForMissingFile(t *testing.T) {
+	t.Parallel()
+	f := &history.File{Path: filepath.Join(t.TempDir(), "missing")}
+	got, err := f.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("want no entries, got %q", got)
+	}
+}
+
+func TestFileAppend_IsSafeForConcurrentWriters(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "history")
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every writer opens the file on its own, like separate sessions
+			f := &history.File{Path: path, MaxSize: 1000, Mode: history.IgnoreDups}
+			for j := range 50 {
+				if _, err := f.Append(fmt.Sprintf("%d %d", i, j)); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	if len(got) != 400 {
+		t.Errorf("want 400 entries, got %d", len(got))
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package history
+
+import "os"
+
+// lock is a no-op where flock is not available; processes appending at the
+// same time may then lose entries.
+func lock(*os.File, bool) error { return nil }
+
+func unlock(*os.File) error { return nil }
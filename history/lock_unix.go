@@ -0,0 +1,23 @@
+//go:build unix
+
+package history
+
+import (
+	"os"
+	"syscall"
+)
+
+// lock takes an advisory lock on file, shared for reading and exclusive for
+// writing, waiting for other processes to release theirs.
+func lock(file *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	return syscall.Flock(int(file.Fd()), how)
+}
+
+func unlock(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
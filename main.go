@@ -3,9 +3,9 @@ package main
 import (
 	"os"
 
-	"github.com/azr4e1/polacco/ui"
+	"github.com/azr4e1/polacco/cli"
 )
 
 func main() {
-	os.Exit(ui.Main())
+	os.Exit(cli.Main(os.Args[1:]))
 }
@@ -0,0 +1,9 @@
+package readline
+
+var (
+	Clusters     = clusters
+	PrevBoundary = prevBoundary
+	SnapBoundary = snapBoundary
+	FitLeft      = fitLeft
+	FitRight     = fitRight
+)
@@ -0,0 +1,104 @@
+package readline
+
+import "github.com/rivo/uniseg"
+
+// The input is edited by grapheme cluster, what the user sees as a single
+// character, such as é written as e and a combining accent. Positions in
+// the input are still byte offsets, but the cursor and the edges of the
+// visible part of the input always fall between two clusters.
+
+// clusters returns the byte offsets at which the grapheme clusters of s
+// start, followed by len(s), and the number of cells each one takes on the
+// screen.
+func clusters(s string) ([]int, []int) {
+	bounds, widths := []int{0}, []int{}
+	pos, state := 0, -1
+	for pos < len(s) {
+		cluster, _, width, newState := uniseg.FirstGraphemeClusterInString(s[pos:], state)
+		pos += len(cluster)
+		state = newState
+		bounds = append(bounds, pos)
+		widths = append(widths, width)
+	}
+
+	return bounds, widths
+}
+
+// nextBoundary returns the end of the cluster of s that starts at byte pos,
+// or len(s) if pos is at the end.
+func nextBoundary(s string, pos int) int {
+	if pos >= len(s) {
+		return len(s)
+	}
+	cluster, _, _, _ := uniseg.FirstGraphemeClusterInString(s[pos:], -1)
+
+	return pos + len(cluster)
+}
+
+// prevBoundary returns the start of the cluster of s that ends at byte
+// pos, or 0 if pos is at the start.
+func prevBoundary(s string, pos int) int {
+	bounds, _ := clusters(s)
+	for i := len(bounds) - 1; i >= 0; i-- {
+		if bounds[i] < pos {
+			return bounds[i]
+		}
+	}
+
+	return 0
+}
+
+// snapBoundary returns the first boundary between clusters of s at or
+// after byte pos.
+func snapBoundary(s string, pos int) int {
+	bounds, _ := clusters(s)
+	for _, bound := range bounds {
+		if bound >= pos {
+			return bound
+		}
+	}
+
+	return len(s)
+}
+
+// fitRight returns the furthest boundary of s after byte left such that
+// s[left:right] takes at most width cells.
+func fitRight(s string, left, width int) int {
+	bounds, widths := clusters(s)
+	total := 0
+	for i, bound := range bounds[:len(widths)] {
+		if bound < left {
+			continue
+		}
+		if total+widths[i] > width {
+			return bound
+		}
+		total += widths[i]
+	}
+
+	return len(s)
+}
+
+// fitLeft returns the furthest boundary of s before byte right such that
+// s[left:right] takes at most width cells.
+func fitLeft(s string, right, width int) int {
+	bounds, widths := clusters(s)
+	total := 0
+	for i := len(widths) - 1; i >= 0; i-- {
+		if bounds[i+1] > right {
+			continue
+		}
+		if total+widths[i] > width {
+			return bounds[i+1]
+		}
+		total += widths[i]
+	}
+
+	return 0
+}
+
+// stringWidth returns the number of cells s takes on the screen, measured
+// like the clusters returned by clusters.
+func stringWidth(s string) int {
+	return uniseg.StringWidth(s)
+}
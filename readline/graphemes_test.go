@@ -0,0 +1,106 @@
+package readline_test
+
+import (
+	"testing"
+
+	"github.com/azr4e1/polacco/readline"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClusters_ReturnsBoundsAndWidths(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input  string
+		Bounds []int
+		Widths []int
+	}
+	testCases := []TestCase{
+		{Input: "", Bounds: []int{0}, Widths: []int{}},
+		{Input: "e\u0301x", Bounds: []int{0, 3, 4}, Widths: []int{1, 1}},
+		{Input: "a漢字b", Bounds: []int{0, 1, 4, 7, 8}, Widths: []int{1, 2, 2, 1}},
+		{Input: "2×3÷√π", Bounds: []int{0, 1, 3, 4, 6, 9, 11}, Widths: []int{1, 1, 1, 1, 1, 1}},
+	}
+	for _, tc := range testCases {
+		bounds, widths := readline.Clusters(tc.Input)
+		if !cmp.Equal(tc.Bounds, bounds) {
+			t.Errorf("%q: %s", tc.Input, cmp.Diff(tc.Bounds, bounds))
+		}
+		if !cmp.Equal(tc.Widths, widths) {
+			t.Errorf("%q: %s", tc.Input, cmp.Diff(tc.Widths, widths))
+		}
+	}
+}
+
+func TestBoundaries_FallBetweenClusters(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input string
+		Pos   int
+		Prev  int
+		Snap  int
+	}
+	testCases := []TestCase{
+		{Input: "e\u0301x", Pos: 0, Prev: 0, Snap: 0},
+		{Input: "e\u0301x", Pos: 1, Prev: 0, Snap: 3},
+		{Input: "e\u0301x", Pos: 3, Prev: 0, Snap: 3},
+		{Input: "e\u0301x", Pos: 4, Prev: 3, Snap: 4},
+		{Input: "a漢字b", Pos: 2, Prev: 1, Snap: 4},
+		{Input: "a漢字b", Pos: 7, Prev: 4, Snap: 7},
+		{Input: "2×3÷√π", Pos: 10, Prev: 9, Snap: 11},
+	}
+	for _, tc := range testCases {
+		if got := readline.PrevBoundary(tc.Input, tc.Pos); tc.Prev != got {
+			t.Errorf("%q at %d: want previous boundary %d, got %d", tc.Input, tc.Pos, tc.Prev, got)
+		}
+		if got := readline.SnapBoundary(tc.Input, tc.Pos); tc.Snap != got {
+			t.Errorf("%q at %d: want boundary %d, got %d", tc.Input, tc.Pos, tc.Snap, got)
+		}
+	}
+}
+
+func TestFitRight_FitsWholeClustersInWidth(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input string
+		Left  int
+		Width int
+		Right int
+	}
+	testCases := []TestCase{
+		{Input: "a漢字b", Left: 0, Width: 3, Right: 4},
+		{Input: "a漢字b", Left: 0, Width: 2, Right: 1},
+		{Input: "a漢字b", Left: 1, Width: 4, Right: 7},
+		{Input: "a漢字b", Left: 1, Width: 1, Right: 1},
+		{Input: "a漢字b", Left: 0, Width: 80, Right: 8},
+		{Input: "e\u0301x", Left: 0, Width: 1, Right: 3},
+		{Input: "2×3÷√π", Left: 1, Width: 3, Right: 6},
+	}
+	for _, tc := range testCases {
+		if got := readline.FitRight(tc.Input, tc.Left, tc.Width); tc.Right != got {
+			t.Errorf("%q from %d in %d cells: want %d, got %d", tc.Input, tc.Left, tc.Width, tc.Right, got)
+		}
+	}
+}
+
+func TestFitLeft_FitsWholeClustersInWidth(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input string
+		Right int
+		Width int
+		Left  int
+	}
+	testCases := []TestCase{
+		{Input: "a漢字b", Right: 8, Width: 3, Left: 4},
+		{Input: "a漢字b", Right: 7, Width: 3, Left: 4},
+		{Input: "a漢字b", Right: 7, Width: 4, Left: 1},
+		{Input: "a漢字b", Right: 8, Width: 80, Left: 0},
+		{Input: "e\u0301x", Right: 4, Width: 1, Left: 3},
+		{Input: "2×3÷√π", Right: 11, Width: 2, Left: 6},
+	}
+	for _, tc := range testCases {
+		if got := readline.FitLeft(tc.Input, tc.Right, tc.Width); tc.Left != got {
+			t.Errorf("%q up to %d in %d cells: want %d, got %d", tc.Input, tc.Right, tc.Width, tc.Left, got)
+		}
+	}
+}
@@ -17,6 +17,7 @@ type KeyMap struct {
 	Delete             key.Binding
 	Backspace          key.Binding
 	Esc                key.Binding
+	Search             key.Binding
 	DeleteAfterCursor  key.Binding
 	DeleteBeforeCursor key.Binding
 }
@@ -70,6 +71,10 @@ var DefaultKeyMap = KeyMap{
 		key.WithKeys("backspace"),
 	),
 	Esc: key.NewBinding(
-		key.WithKeys("esc"),
+		key.WithKeys("esc", "ctrl+g"),
+	),
+	Search: key.NewBinding(
+		key.WithKeys("ctrl+r"),
+		key.WithHelp("C-r", "search history"),
 	),
 }
@@ -1,8 +1,11 @@
 package readline
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 
+	"github.com/azr4e1/polacco/history"
 	"github.com/charmbracelet/bubbles/cursor"
 	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
@@ -21,17 +24,32 @@ type Model struct {
 	MaxHistorySize int
 	TextStyle      lipgloss.Style
 	PromptStyle    lipgloss.Style
+	HighlightStyle lipgloss.Style
 	Width          int
+	// PrefixSearch makes Up and Down only go through the entries of the
+	// history that start with the text typed so far.
+	PrefixSearch bool
 
 	currentPrompt       string
 	history             []string
 	historyPointer      int
 	historyPromptCached string
+	historyMode         history.Mode
+	historyFile         *history.File
 	cursorPointer       int
 	cursor              cursor.Model
 	windowWidth         int
 	offsetLeft          int
 	offsetRight         int
+	highlightStart      int
+	highlightEnd        int
+
+	// reverse-i-search
+	searching     bool
+	searchQuery   string
+	searchPointer int
+	searchFailed  bool
+	searchSaved   string
 }
 
 func New(opts ...option) Model {
@@ -39,9 +57,10 @@ func New(opts ...option) Model {
 	textStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#ffffff"))
 	m := &Model{
 		Prompt:         "> ",
-		MaxHistorySize: 100,
+		MaxHistorySize: history.DefaultMaxSize,
 		TextStyle:      textStyle,
 		PromptStyle:    textStyle,
+		HighlightStyle: textStyle.Underline(true).Foreground(lipgloss.Color("#ff0000")),
 		Width:          -1,
 		cursor:         cursor.New(),
 	}
@@ -56,6 +75,13 @@ func New(opts ...option) Model {
 			continue
 		}
 	}
+	if m.historyFile != nil {
+		m.historyFile.MaxSize = m.MaxHistorySize
+		m.historyFile.Mode = m.historyMode
+		if lines, err := m.historyFile.Load(); err == nil {
+			m.SetHistory(lines)
+		}
+	}
 
 	return *m
 }
@@ -67,13 +93,50 @@ func SetPrompt(prompt string) option {
 	}
 }
 
+// SetMaxHistory sets how many entries the history keeps, and the history
+// file is trimmed to. The size must be at least 1.
 func SetMaxHistory(mh int) option {
 	return func(m *Model) error {
+		if mh < 1 {
+			return errors.New("history size must be at least 1")
+		}
 		m.MaxHistorySize = mh
 		return nil
 	}
 }
 
+// SetHistoryFile keeps the history in the file at path, which is loaded by
+// New and appended to on every entered line. Several readlines, in the
+// same process or not, can share a file. An empty path keeps the history
+// in memory only.
+func SetHistoryFile(path string) option {
+	return func(m *Model) error {
+		m.historyFile = nil
+		if path != "" {
+			m.historyFile = &history.File{Path: path}
+		}
+		return nil
+	}
+}
+
+// SetHistoryMode sets which entered lines are left out of the history.
+func SetHistoryMode(mode history.Mode) option {
+	return func(m *Model) error {
+		m.historyMode = mode
+		return nil
+	}
+}
+
+// SetPrefixSearch sets whether Up and Down only go through the entries of
+// the history that start with the text typed so far, like
+// history-beginning-search-backward in zsh.
+func SetPrefixSearch(enabled bool) option {
+	return func(m *Model) error {
+		m.PrefixSearch = enabled
+		return nil
+	}
+}
+
 func SetCursorStyle(style lipgloss.Style) option {
 	return func(m *Model) error {
 		m.cursor.Style = style
@@ -96,6 +159,13 @@ func SetPromptStyle(style lipgloss.Style) option {
 	}
 }
 
+func SetHighlightStyle(style lipgloss.Style) option {
+	return func(m *Model) error {
+		m.HighlightStyle = style
+		return nil
+	}
+}
+
 func SetWidth(width int) option {
 	return func(m *Model) error {
 		m.Width = width
@@ -103,8 +173,9 @@ func SetWidth(width int) option {
 	}
 }
 
+// paddingRight pads output with padChar until it takes padLength cells.
 func paddingRight(output, padChar string, padLength int) string {
-	diff := padLength - len(output)
+	diff := padLength - stringWidth(output)
 	if diff > 0 {
 		output += strings.Repeat(padChar, diff)
 	}
@@ -112,36 +183,110 @@ func paddingRight(output, padChar string, padLength int) string {
 	return output
 }
 
+// renderText renders text, which starts at byte pos of the current input,
+// drawing the highlighted part of the input with HighlightStyle.
+func (m Model) renderText(text string, pos int) string {
+	start := min(max(m.highlightStart-pos, 0), len(text))
+	end := min(max(m.highlightEnd-pos, start), len(text))
+	if start == end {
+		return m.TextStyle.Inline(true).Render(text)
+	}
+
+	return m.TextStyle.Inline(true).Render(text[:start]) +
+		m.HighlightStyle.Inline(true).Render(text[start:end]) +
+		m.TextStyle.Inline(true).Render(text[end:])
+}
+
 func (m Model) View() string {
 	output := m.PromptStyle.Inline(true).Render(m.Prompt)
-	currentPrompt := paddingRight(m.currentPrompt[m.offsetLeft:m.offsetRight], " ", m.Width-len(m.Prompt))
-	cursorPointer := m.cursorPointer - m.offsetLeft
-	switch cursorPointer {
-	case len(currentPrompt):
-		// if m.offsetRight < len(m.currentPrompt)
-		output += m.TextStyle.Inline(true).Render(currentPrompt) + m.cursor.View()
-
-	case len(currentPrompt) - 1:
-		output += m.TextStyle.Inline(true).Render(currentPrompt[:len(currentPrompt)-1]) + m.cursor.View()
+	visible := m.currentPrompt[m.offsetLeft:m.offsetRight]
+	cursorPointer := min(max(m.cursorPointer-m.offsetLeft, 0), len(visible))
+	// the cursor is drawn over the cluster under it, or past the end of the
+	// input
+	prev := visible[:cursorPointer]
+	under := visible[cursorPointer:nextBoundary(visible, cursorPointer)]
+	next := paddingRight(visible[cursorPointer+len(under):], " ", m.Width-stringWidth(m.Prompt)-stringWidth(prev)-max(stringWidth(under), 1))
+	output += m.renderText(prev, m.offsetLeft) + m.cursor.View() + m.renderText(next, m.offsetLeft+cursorPointer+len(under))
+
+	if m.searching {
+		output += "\n" + m.PromptStyle.Inline(true).Render(m.searchStatus())
+	}
 
-	case 0:
-		output += m.cursor.View() + m.TextStyle.Inline(true).Render(currentPrompt[1:])
+	return output
+}
 
-	default:
-		prev := currentPrompt[:cursorPointer]
-		next := currentPrompt[cursorPointer+1:]
-		output += m.TextStyle.Inline(true).Render(prev) + m.cursor.View() + m.TextStyle.Inline(true).Render(next)
+// searchStatus describes the search in progress like bash does:
+// (reverse-i-search)`query'.
+func (m Model) searchStatus() string {
+	status := fmt.Sprintf("(reverse-i-search)`%s'", m.searchQuery)
+	if m.searchFailed {
+		status = "(failed " + status[1:]
+	}
+	if m.Width > 0 {
+		status = status[:fitRight(status, 0, m.Width)]
 	}
 
-	return output
+	return status
+}
+
+// Searching reports whether a reverse-i-search is in progress, in which
+// case View renders a status line below the input.
+func (m Model) Searching() bool {
+	return m.searching
+}
+
+// Value returns the current input.
+func (m Model) Value() string {
+	return m.currentPrompt
+}
+
+// SetValue replaces the current input with value and moves the cursor to
+// its end.
+func (m *Model) SetValue(value string) {
+	m.currentPrompt = value
+	m.cursorPointer = len(value)
+	m.cursor.SetChar(EmptyChar)
+	m.cacheHistory()
+	m.handleOverflow()
+}
+
+// SetHistory replaces the history, oldest entry first, for example with
+// one restored from a previous session.
+func (m *Model) SetHistory(history []string) {
+	// like updateHistory, a MaxHistorySize of 0 or less keeps no entries
+	keep := min(max(m.MaxHistorySize, 0), len(history))
+	m.history = append([]string{}, history[len(history)-keep:]...)
+	m.historyPointer = len(m.history)
+	m.historyPromptCached = ""
+}
+
+// Highlight marks the bytes of the current input between start and end,
+// for example the token an error refers to. The mark is removed as soon as
+// the input changes.
+func (m *Model) Highlight(start, end int) {
+	m.highlightStart = max(0, start)
+	m.highlightEnd = min(end, len(m.currentPrompt))
 }
 
 func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 	var cmds []tea.Cmd
 	oldPos := m.cursorPointer //nolint
+	oldPrompt := m.currentPrompt
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.searching && m.updateSearch(msg) {
+			break
+		}
 		switch {
+		case key.Matches(msg, DefaultKeyMap.Search):
+			m.startSearch()
+
+		case key.Matches(msg, DefaultKeyMap.Up) && m.PrefixSearch:
+			m.prevHistoryMatch()
+
+		case key.Matches(msg, DefaultKeyMap.Down) && m.PrefixSearch:
+			m.nextHistoryMatch()
+
 		case key.Matches(msg, DefaultKeyMap.Up):
 			m.decreaseHistoryPointer(1)
 			m.setHistoryPrompt()
@@ -199,46 +344,52 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 		cmds = append(cmds, m.cursor.BlinkCmd())
 	}
 
+	if oldPrompt != m.currentPrompt {
+		m.Highlight(0, 0)
+	}
+	if m.searching {
+		// mark the part of the match the query refers to
+		if i := strings.Index(m.currentPrompt, m.searchQuery); i >= 0 && m.searchQuery != "" {
+			m.Highlight(i, i+len(m.searchQuery))
+		}
+	}
+
 	m.handleOverflow()
 	return m, tea.Batch(cmds...)
 }
 
+// increaseCursor moves the cursor n clusters to the right.
 func (m *Model) increaseCursor(n int) {
-	if m.cursorPointer+n >= len(m.currentPrompt) {
-		m.cursorPointer = len(m.currentPrompt)
-		m.cursor.SetChar(EmptyChar)
-		return
+	for ; n > 0 && m.cursorPointer < len(m.currentPrompt); n-- {
+		m.cursorPointer = nextBoundary(m.currentPrompt, m.cursorPointer)
 	}
-
-	m.cursorPointer += n
-	m.cursor.SetChar(string(m.currentPrompt[m.cursorPointer]))
+	m.setCursorChar()
 }
 
+// decreaseCursor moves the cursor n clusters to the left.
 func (m *Model) decreaseCursor(n int) {
-	if m.cursorPointer-n <= 0 {
-		m.cursorPointer = 0
-		if len(m.currentPrompt) == 0 {
-			m.cursor.SetChar(EmptyChar)
-			return
-		}
-		m.cursor.SetChar(string(m.currentPrompt[m.cursorPointer]))
-		return
+	for ; n > 0 && m.cursorPointer > 0; n-- {
+		m.cursorPointer = prevBoundary(m.currentPrompt, m.cursorPointer)
 	}
+	m.setCursorChar()
+}
 
-	m.cursorPointer -= n
-	if len(m.currentPrompt) == m.cursorPointer {
+// setCursorChar shows the cluster under the cursor in the cursor.
+func (m *Model) setCursorChar() {
+	if m.cursorPointer >= len(m.currentPrompt) {
 		m.cursor.SetChar(EmptyChar)
 		return
 	}
-	m.cursor.SetChar(string(m.currentPrompt[m.cursorPointer]))
+	m.cursor.SetChar(m.currentPrompt[m.cursorPointer:nextBoundary(m.currentPrompt, m.cursorPointer)])
 }
 
 func (m *Model) updateCurrentInput(msg string) {
-
 	prev := m.currentPrompt[:m.cursorPointer]
 	next := m.currentPrompt[m.cursorPointer:]
 	m.currentPrompt = prev + msg + next
-	m.increaseCursor(len(msg))
+	// msg can join the cluster before or after it, as a combining accent does
+	m.cursorPointer = snapBoundary(m.currentPrompt, len(prev)+len(msg))
+	m.setCursorChar()
 	m.cacheHistory()
 }
 
@@ -254,28 +405,22 @@ func (m *Model) tab() {
 }
 
 func (m *Model) backspace() {
-	prev := m.currentPrompt[:m.cursorPointer]
-	next := m.currentPrompt[m.cursorPointer:]
-	if len(prev) > 0 {
-		m.currentPrompt = prev[:len(prev)-1] + next
-		m.decreaseCursor(1)
+	if m.cursorPointer > 0 {
+		start := prevBoundary(m.currentPrompt, m.cursorPointer)
+		m.currentPrompt = m.currentPrompt[:start] + m.currentPrompt[m.cursorPointer:]
+		m.cursorPointer = start
+		m.setCursorChar()
 	}
 	m.cacheHistory()
 }
 
 func (m *Model) delete() {
-	prev := m.currentPrompt[:m.cursorPointer]
-	next := m.currentPrompt[m.cursorPointer:]
-	if len(next) > 0 {
-		m.currentPrompt = prev + next[1:]
+	if m.cursorPointer < len(m.currentPrompt) {
+		end := nextBoundary(m.currentPrompt, m.cursorPointer)
+		m.currentPrompt = m.currentPrompt[:m.cursorPointer] + m.currentPrompt[end:]
 		m.cacheHistory()
-
-		if len(next[1:]) > 0 {
-			m.cursor.SetChar(string(next[1]))
-			return
-		}
 	}
-	m.cursor.SetChar(EmptyChar)
+	m.setCursorChar()
 }
 
 func (m *Model) enter() tea.Cmd {
@@ -306,9 +451,17 @@ func (m *Model) increaseHistoryPointer(n int) {
 }
 
 func (m *Model) updateHistory(input string) {
-	if strings.TrimSpace(input) == "" {
+	prev := ""
+	if len(m.history) > 0 {
+		prev = m.history[len(m.history)-1]
+	}
+	if m.historyMode.Ignore(input, prev) {
 		return
 	}
+	if m.historyFile != nil {
+		// a failed write only loses the line for later sessions
+		m.historyFile.Append(input) //nolint:errcheck
+	}
 	if m.MaxHistorySize <= 0 {
 		m.history = []string{}
 		return
@@ -320,6 +473,39 @@ func (m *Model) updateHistory(input string) {
 	m.historyPromptCached = ""
 }
 
+// prevHistoryMatch moves to the previous entry of the history that starts
+// with the cached prompt, the text typed before moving through the history.
+// Entries equal to the input are skipped, so repeated entries are only
+// shown once.
+func (m *Model) prevHistoryMatch() {
+	for i := min(m.historyPointer, len(m.history)) - 1; i >= 0; i-- {
+		if m.matchesHistoryPrefix(i) {
+			m.historyPointer = i
+			m.setHistoryPrompt()
+			return
+		}
+	}
+}
+
+// nextHistoryMatch is like prevHistoryMatch, but moves forward. Past the
+// last match it goes back to the cached prompt.
+func (m *Model) nextHistoryMatch() {
+	for i := m.historyPointer + 1; i < len(m.history); i++ {
+		if m.matchesHistoryPrefix(i) {
+			m.historyPointer = i
+			m.setHistoryPrompt()
+			return
+		}
+	}
+	m.historyPointer = len(m.history)
+	m.setHistoryPrompt()
+}
+
+func (m *Model) matchesHistoryPrefix(i int) bool {
+	entry := m.history[i]
+	return strings.HasPrefix(entry, m.historyPromptCached) && entry != m.currentPrompt
+}
+
 func (m *Model) setHistoryPrompt() {
 	if m.historyPointer >= len(m.history) {
 		m.currentPrompt = m.historyPromptCached
@@ -332,7 +518,97 @@ func (m *Model) setHistoryPrompt() {
 	m.cursor.SetChar(EmptyChar)
 }
 
+// esc cancels the search in progress, restoring the input it started from.
 func (m *Model) esc() {
+	if !m.searching {
+		return
+	}
+	m.searching = false
+	m.searchFailed = false
+	m.currentPrompt = m.searchSaved
+	m.cursorPointer = len(m.currentPrompt)
+	m.cursor.SetChar(EmptyChar)
+	m.Highlight(0, 0)
+}
+
+func (m *Model) startSearch() {
+	m.searching = true
+	m.searchQuery = ""
+	m.searchPointer = len(m.history)
+	m.searchFailed = false
+	m.searchSaved = m.currentPrompt
+}
+
+// updateSearch handles a key pressed during a search. Keys that do not
+// edit the search accept the match and are left to the caller, which
+// reports false for them: Enter then runs the match, and the arrows start
+// editing it.
+func (m *Model) updateSearch(msg tea.KeyMsg) bool {
+	switch {
+	case key.Matches(msg, DefaultKeyMap.Search):
+		// the next older match
+		if m.searchQuery != "" {
+			m.search(m.searchPointer - 1)
+		}
+
+	case key.Matches(msg, DefaultKeyMap.Esc):
+		m.esc()
+
+	case key.Matches(msg, DefaultKeyMap.Backspace):
+		if m.searchQuery == "" {
+			return true
+		}
+		m.searchQuery = m.searchQuery[:prevBoundary(m.searchQuery, len(m.searchQuery))]
+		if m.searchQuery == "" {
+			m.searchFailed = false
+			m.searchPointer = len(m.history)
+			m.setSearchPrompt(m.searchSaved)
+			return true
+		}
+		m.search(len(m.history) - 1)
+
+	case msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace:
+		// the current match is kept as long as it matches
+		m.searchQuery += msg.String()
+		m.search(min(m.searchPointer, len(m.history)-1))
+
+	default:
+		m.acceptSearch()
+		return false
+	}
+
+	return true
+}
+
+// search shows the latest entry of the history that contains the query,
+// starting from entry from and going back. If there is none, the last
+// match stays and the search is marked as failed.
+func (m *Model) search(from int) {
+	for i := from; i >= 0; i-- {
+		if strings.Contains(m.history[i], m.searchQuery) {
+			m.searchPointer = i
+			m.searchFailed = false
+			m.setSearchPrompt(m.history[i])
+			return
+		}
+	}
+	m.searchFailed = true
+}
+
+func (m *Model) setSearchPrompt(prompt string) {
+	m.currentPrompt = prompt
+	m.cursorPointer = len(prompt)
+	m.cursor.SetChar(EmptyChar)
+}
+
+// acceptSearch ends the search, keeping the match as the input. Up and
+// Down then move through the history from the match.
+func (m *Model) acceptSearch() {
+	m.searching = false
+	m.searchFailed = false
+	m.historyPointer = m.searchPointer
+	m.historyPromptCached = m.searchSaved
+	m.Highlight(0, 0)
 }
 
 func (m *Model) deleteAfterCursor() {
@@ -346,7 +622,8 @@ func (m *Model) deleteBeforeCursor() {
 	next := m.currentPrompt[m.cursorPointer:]
 	m.currentPrompt = next
 	m.cacheHistory()
-	m.decreaseCursor(m.cursorPointer)
+	m.cursorPointer = 0
+	m.setCursorChar()
 }
 
 func (m *Model) Blink() tea.Cmd {
@@ -357,29 +634,30 @@ func (m *Model) BlinkOff() {
 	m.cursor.Blink = false
 }
 
+// handleOverflow scrolls the input horizontally so that the cursor, and
+// the cluster under it, stay visible. Offsets are bytes of the input, and
+// widths are measured in cells.
 func (m *Model) handleOverflow() {
 	var maxWidth int
 	if m.Width <= 0 {
-		maxWidth = max(0, m.windowWidth-len(m.Prompt)-1)
+		maxWidth = max(0, m.windowWidth-stringWidth(m.Prompt)-1)
 	} else {
-		maxWidth = max(0, min(m.Width, m.windowWidth)-len(m.Prompt)-1)
+		maxWidth = max(0, min(m.Width, m.windowWidth)-stringWidth(m.Prompt)-1)
 	}
 
-	if len(m.currentPrompt)+len(m.Prompt) <= maxWidth {
+	if stringWidth(m.currentPrompt) <= maxWidth {
 		m.offsetLeft = 0
 		m.offsetRight = len(m.currentPrompt)
 		return
 	}
-	m.offsetRight = min(m.offsetRight, len(m.currentPrompt))
-	m.offsetLeft = max(m.offsetLeft, 0)
-
-	if m.cursorPointer < m.offsetLeft {
-		m.offsetLeft = m.cursorPointer
-		m.offsetRight = min(m.offsetLeft+maxWidth, len(m.currentPrompt))
-	}
-
-	if m.cursorPointer >= m.offsetRight {
-		m.offsetRight = min(m.cursorPointer+1, len(m.currentPrompt))
-		m.offsetLeft = max(m.offsetRight-maxWidth, 0)
+	m.offsetLeft = snapBoundary(m.currentPrompt, min(m.offsetLeft, m.cursorPointer))
+	m.offsetRight = fitRight(m.currentPrompt, m.offsetLeft, maxWidth)
+
+	// scroll to the right if the cursor is past the visible part, and to the
+	// left if there is room left at the end
+	cursorEnd := nextBoundary(m.currentPrompt, m.cursorPointer)
+	if cursorEnd > m.offsetRight || m.offsetRight == len(m.currentPrompt) {
+		m.offsetRight = max(cursorEnd, m.offsetRight)
+		m.offsetLeft = min(fitLeft(m.currentPrompt, m.offsetRight, maxWidth), m.cursorPointer)
 	}
 }
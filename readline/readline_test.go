@@ -0,0 +1,228 @@
+package readline_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/azr4e1/polacco/readline"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/google/go-cmp/cmp"
+)
+
+var (
+	ctrlR     = tea.KeyMsg{Type: tea.KeyCtrlR}
+	up        = tea.KeyMsg{Type: tea.KeyUp}
+	down      = tea.KeyMsg{Type: tea.KeyDown}
+	backspace = tea.KeyMsg{Type: tea.KeyBackspace}
+	esc       = tea.KeyMsg{Type: tea.KeyEsc}
+	enter     = tea.KeyMsg{Type: tea.KeyEnter}
+)
+
+func typed(text string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(text)}
+}
+
+// newModel returns a readline with history and input, sized like a
+// terminal 80 cells wide.
+func newModel(history []string, input string) readline.Model {
+	m := readline.New()
+	m.SetHistory(history)
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 80, Height: 24})
+	if input != "" {
+		m, _ = m.Update(typed(input))
+	}
+
+	return m
+}
+
+// press sends keys to m and returns the last command they produced.
+func press(m readline.Model, keys ...tea.KeyMsg) (readline.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	for _, k := range keys {
+		m, cmd = m.Update(k)
+	}
+
+	return m, cmd
+}
+
+// statusLine returns the last line of the view of m.
+func statusLine(m readline.Model) string {
+	lines := strings.Split(m.View(), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+func TestModelUpdate_SearchesTheHistory(t *testing.T) {
+	t.Parallel()
+	history := []string{"1 2 +", "3 sqrt", "1 5 +", "5 5 *"}
+	type TestCase struct {
+		Keys      []tea.KeyMsg
+		Value     string
+		Searching bool
+		Status    string
+	}
+	testCases := []TestCase{
+		{
+			Keys:      []tea.KeyMsg{ctrlR},
+			Value:     "7",
+			Searching: true,
+			Status:    "(reverse-i-search)`'",
+		},
+		{
+			Keys:      []tea.KeyMsg{ctrlR, typed("1")},
+			Value:     "1 5 +",
+			Searching: true,
+			Status:    "(reverse-i-search)`1'",
+		},
+		{
+			Keys:      []tea.KeyMsg{ctrlR, typed("1"), ctrlR},
+			Value:     "1 2 +",
+			Searching: true,
+			Status:    "(reverse-i-search)`1'",
+		},
+		{
+			Keys:      []tea.KeyMsg{ctrlR, typed("1"), ctrlR, ctrlR},
+			Value:     "1 2 +",
+			Searching: true,
+			Status:    "(failed reverse-i-search)`1'",
+		},
+		{
+			Keys:      []tea.KeyMsg{ctrlR, typed("x")},
+			Value:     "7",
+			Searching: true,
+			Status:    "(failed reverse-i-search)`x'",
+		},
+		{
+			Keys:      []tea.KeyMsg{ctrlR, typed("s"), typed("q"), typed("x"), backspace},
+			Value:     "3 sqrt",
+			Searching: true,
+			Status:    "(reverse-i-search)`sq'",
+		},
+		{
+			Keys:      []tea.KeyMsg{ctrlR, typed("s"), backspace},
+			Value:     "7",
+			Searching: true,
+			Status:    "(reverse-i-search)`'",
+		},
+		{
+			Keys:      []tea.KeyMsg{ctrlR, typed("1"), ctrlR, esc},
+			Value:     "7",
+			Searching: false,
+		},
+		{
+			Keys:      []tea.KeyMsg{ctrlR, typed("1"), ctrlR, down},
+			Value:     "3 sqrt",
+			Searching: false,
+		},
+	}
+	for _, tc := range testCases {
+		m, _ := press(newModel(history, "7"), tc.Keys...)
+		if got := m.Value(); tc.Value != got {
+			t.Errorf("%v: want value %q, got %q", tc.Keys, tc.Value, got)
+		}
+		if got := m.Searching(); tc.Searching != got {
+			t.Errorf("%v: want searching %t, got %t", tc.Keys, tc.Searching, got)
+		}
+		if got := statusLine(m); tc.Searching && tc.Status != got {
+			t.Errorf("%v: want status %q, got %q", tc.Keys, tc.Status, got)
+		}
+	}
+}
+
+func TestModelUpdate_RunsTheMatchOnEnter(t *testing.T) {
+	t.Parallel()
+	m := newModel([]string{"1 2 +", "3 sqrt", "5 5 *"}, "")
+
+	m, cmd := press(m, ctrlR, typed("sq"), enter)
+	if m.Searching() {
+		t.Error("want the search to end")
+	}
+	if got := readlineMsg(cmd); got != "3 sqrt" {
+		t.Errorf("want 3 sqrt to run, got %q", got)
+	}
+	want := []string{"3 sqrt", "5 5 *", "3 sqrt"}
+	got := []string{}
+	for range want {
+		m, _ = press(m, up)
+		got = append(got, m.Value())
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestModelUpdate_FiltersTheHistoryByPrefix(t *testing.T) {
+	t.Parallel()
+	history := []string{"1 2 +", "3 sqrt", "1 5 +", "1 5 +", "5 5 *"}
+	type TestCase struct {
+		Input string
+		Keys  []tea.KeyMsg
+		Value string
+	}
+	testCases := []TestCase{
+		{Input: "1", Keys: []tea.KeyMsg{up}, Value: "1 5 +"},
+		{Input: "1", Keys: []tea.KeyMsg{up, up}, Value: "1 2 +"},
+		{Input: "1", Keys: []tea.KeyMsg{up, up, up}, Value: "1 2 +"},
+		{Input: "1", Keys: []tea.KeyMsg{up, up, up, down}, Value: "1 5 +"},
+		{Input: "1", Keys: []tea.KeyMsg{up, up, up, down, down}, Value: "1"},
+		{Input: "1", Keys: []tea.KeyMsg{down}, Value: "1"},
+		{Input: "3", Keys: []tea.KeyMsg{up, up}, Value: "3 sqrt"},
+		{Input: "7", Keys: []tea.KeyMsg{up}, Value: "7"},
+		{Input: "", Keys: []tea.KeyMsg{up, up, up}, Value: "3 sqrt"},
+	}
+	for _, tc := range testCases {
+		m := newModel(history, tc.Input)
+		m.PrefixSearch = true
+		m, _ = press(m, tc.Keys...)
+		if got := m.Value(); tc.Value != got {
+			t.Errorf("%q %v: want %q, got %q", tc.Input, tc.Keys, tc.Value, got)
+		}
+	}
+}
+
+func TestModelSetHistory_KeepsAtMostMaxHistorySizeEntries(t *testing.T) {
+	t.Parallel()
+	history := []string{"1 2 +", "3 sqrt", "5 5 *"}
+	type TestCase struct {
+		Size int
+		Want []string
+	}
+	testCases := []TestCase{
+		{Size: 5, Want: []string{"5 5 *", "3 sqrt", "1 2 +"}},
+		{Size: 2, Want: []string{"5 5 *", "3 sqrt", "3 sqrt"}},
+		{Size: 0, Want: []string{"", "", ""}},
+		{Size: -1, Want: []string{"", "", ""}},
+	}
+	for _, tc := range testCases {
+		m := readline.New()
+		m.MaxHistorySize = tc.Size
+		m.SetHistory(history)
+		got := []string{}
+		for range tc.Want {
+			m, _ = press(m, up)
+			got = append(got, m.Value())
+		}
+		if !cmp.Equal(tc.Want, got) {
+			t.Errorf("%d: %s", tc.Size, cmp.Diff(tc.Want, got))
+		}
+	}
+}
+
+// readlineMsg returns the line cmd sends to the program, looking through
+// batches of commands. The commands before it, if any, must not block.
+func readlineMsg(cmd tea.Cmd) string {
+	if cmd == nil {
+		return ""
+	}
+	switch msg := cmd().(type) {
+	case readline.ReadlineMsg:
+		return string(msg)
+	case tea.BatchMsg:
+		for _, cmd := range msg {
+			if line := readlineMsg(cmd); line != "" {
+				return line
+			}
+		}
+	}
+
+	return ""
+}
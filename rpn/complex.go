@@ -0,0 +1,304 @@
+package rpn
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strconv"
+	"strings"
+)
+
+// Words that build and split complex numbers.
+const (
+	WordRealToComplex = "r->c"
+	WordComplexToReal = "c->r"
+	WordRe            = "re"
+	WordIm            = "im"
+	WordConj          = "conj"
+	WordArg           = "arg"
+)
+
+// RPNComplex is a complex literal such as 3+4i, 2i or (3,4). It can only be
+// pushed on a stack whose backend is a ComplexConverter.
+type RPNComplex complex128
+
+func (c RPNComplex) Apply(s *RPNStack) error {
+	b, ok := s.backend.(ComplexConverter)
+	if !ok {
+		return errors.New("complex numbers require the complex backend")
+	}
+	s.PushNumber(b.FromComplex(complex128(c)))
+
+	return nil
+}
+
+// ComplexConverter is implemented by backends that store complex numbers.
+type ComplexConverter interface {
+	FromComplex(complex128) Number
+	Complex(Number) complex128
+}
+
+type complexBackend struct{}
+
+// ComplexBackend stores numbers as complex128, so that operations such as
+// 0 1 - sqrt or a negative base with a fractional exponent have a result.
+var ComplexBackend Backend = complexBackend{}
+
+func (complexBackend) Name() string {
+	return "complex"
+}
+
+func (complexBackend) Parse(literal string) (Number, error) {
+	x, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return complex(x, 0), nil
+}
+
+func (complexBackend) FromFloat(x float64) Number {
+	return complex(x, 0)
+}
+
+func (complexBackend) FromComplex(x complex128) Number {
+	return x
+}
+
+func (complexBackend) Complex(x Number) complex128 {
+	return x.(complex128)
+}
+
+// Float64 returns the real part of x.
+func (complexBackend) Float64(x Number) float64 {
+	return real(x.(complex128))
+}
+
+// Format prints real numbers like the float backend and other numbers as
+// re+imi, leaving out a zero real part.
+func (complexBackend) Format(x Number) string {
+	val := x.(complex128)
+	if imag(val) == 0 {
+		return fmt.Sprint(real(val))
+	}
+	im := strconv.FormatFloat(imag(val), 'g', -1, 64) + "i"
+	if real(val) == 0 {
+		return im
+	}
+	if !strings.HasPrefix(im, "-") {
+		im = "+" + im
+	}
+
+	return fmt.Sprint(real(val)) + im
+}
+
+func checkComplex(x complex128) (Number, error) {
+	if cmplx.IsNaN(x) || cmplx.IsInf(x) {
+		return nil, errors.New("result is out of range")
+	}
+
+	return x, nil
+}
+
+func (complexBackend) Add(x, y Number) (Number, error) {
+	return checkComplex(x.(complex128) + y.(complex128))
+}
+
+func (complexBackend) Sub(x, y Number) (Number, error) {
+	return checkComplex(x.(complex128) - y.(complex128))
+}
+
+func (complexBackend) Mul(x, y Number) (Number, error) {
+	return checkComplex(x.(complex128) * y.(complex128))
+}
+
+func (complexBackend) Div(x, y Number) (Number, error) {
+	if y.(complex128) == 0 {
+		return nil, errors.New("cannot divide by 0")
+	}
+
+	return checkComplex(x.(complex128) / y.(complex128))
+}
+
+func (complexBackend) Pow(x, y Number) (Number, error) {
+	base, exp := x.(complex128), y.(complex128)
+	if base == 0 && exp == 0 {
+		return nil, checkPow(0, 0)
+	}
+	if base == 0 && real(exp) < 0 {
+		return nil, errors.New("cannot divide by 0")
+	}
+	// keep real powers of real numbers free of rounding in the imaginary part
+	if imag(base) == 0 && imag(exp) == 0 && (real(base) >= 0 || real(exp) == math.Trunc(real(exp))) {
+		return checkComplex(complex(math.Pow(real(base), real(exp)), 0))
+	}
+
+	return checkComplex(cmplx.Pow(base, exp))
+}
+
+func roundParts(x complex128, f func(float64) float64) complex128 {
+	return complex(f(real(x)), f(imag(x)))
+}
+
+func (complexBackend) Unary(name string, x Number) (Number, bool, error) {
+	val := x.(complex128)
+	var result complex128
+	switch name {
+	case FunctionSqrt:
+		if imag(val) == 0 && real(val) >= 0 {
+			result = complex(math.Sqrt(real(val)), 0)
+		} else {
+			result = cmplx.Sqrt(val)
+		}
+	case FunctionCbrt:
+		if imag(val) == 0 {
+			result = complex(math.Cbrt(real(val)), 0)
+		} else {
+			result = cmplx.Pow(val, 1.0/3)
+		}
+	case FunctionLn, FunctionLog, FunctionLog10, FunctionLog2:
+		if val == 0 {
+			return nil, true, errors.New("cannot take the logarithm of 0")
+		}
+		switch name {
+		case FunctionLn:
+			result = cmplx.Log(val)
+		case FunctionLog2:
+			result = cmplx.Log(val) / math.Ln2
+		default:
+			result = cmplx.Log10(val)
+		}
+	case FunctionExp:
+		result = cmplx.Exp(val)
+	case FunctionSin:
+		result = cmplx.Sin(val)
+	case FunctionCos:
+		result = cmplx.Cos(val)
+	case FunctionTan:
+		result = cmplx.Tan(val)
+	case FunctionAsin:
+		result = cmplx.Asin(val)
+	case FunctionAcos:
+		result = cmplx.Acos(val)
+	case FunctionAtan:
+		result = cmplx.Atan(val)
+	case FunctionSinh:
+		result = cmplx.Sinh(val)
+	case FunctionCosh:
+		result = cmplx.Cosh(val)
+	case FunctionTanh:
+		result = cmplx.Tanh(val)
+	case FunctionAsinh:
+		result = cmplx.Asinh(val)
+	case FunctionAcosh:
+		result = cmplx.Acosh(val)
+	case FunctionAtanh:
+		result = cmplx.Atanh(val)
+	case FunctionAbs:
+		result = complex(cmplx.Abs(val), 0)
+	case FunctionNeg:
+		result = -val
+	case FunctionInv:
+		if val == 0 {
+			return nil, true, errors.New("cannot divide by 0")
+		}
+		result = 1 / val
+	case FunctionFloor:
+		result = roundParts(val, math.Floor)
+	case FunctionCeil:
+		result = roundParts(val, math.Ceil)
+	case FunctionRound:
+		result = roundParts(val, math.Round)
+	case FunctionTrunc:
+		result = roundParts(val, math.Trunc)
+	default:
+		return nil, false, nil
+	}
+
+	num, err := checkComplex(result)
+
+	return num, true, err
+}
+
+// complexWord wraps a word that only makes sense with a ComplexConverter.
+func complexWord(name string, f func(*RPNStack, ComplexConverter) error) func(*RPNStack) error {
+	return func(s *RPNStack) error {
+		b, ok := s.backend.(ComplexConverter)
+		if !ok {
+			return &DomainError{Op: name, Err: errors.New("requires the complex backend")}
+		}
+		return f(s, b)
+	}
+}
+
+// complexUnary builds a word that replaces the top of the stack with f of it.
+func complexUnary(name string, f func(complex128) complex128) func(*RPNStack) error {
+	return complexWord(name, func(s *RPNStack, b ComplexConverter) error {
+		val, err := s.PopNumber()
+		if err != nil {
+			return err
+		}
+		s.PushNumber(b.FromComplex(f(b.Complex(val))))
+		return nil
+	})
+}
+
+var complexWords = []Operator{
+	{
+		Name:  WordRealToComplex,
+		Arity: 2,
+		Func: complexWord(WordRealToComplex, func(s *RPNStack, b ComplexConverter) error {
+			im, err := s.PopNumber()
+			if err != nil {
+				return err
+			}
+			re, err := s.PopNumber()
+			if err != nil {
+				return err
+			}
+			s.PushNumber(b.FromComplex(complex(real(b.Complex(re)), real(b.Complex(im)))))
+			return nil
+		}),
+		Help: "re im r->c: build a complex number",
+	},
+	{
+		Name:  WordComplexToReal,
+		Arity: 1,
+		Func: complexWord(WordComplexToReal, func(s *RPNStack, b ComplexConverter) error {
+			val, err := s.PopNumber()
+			if err != nil {
+				return err
+			}
+			z := b.Complex(val)
+			s.PushNumber(b.FromComplex(complex(real(z), 0)))
+			s.PushNumber(b.FromComplex(complex(imag(z), 0)))
+			return nil
+		}),
+		Help: "split a complex number into its real and imaginary parts",
+	},
+	{
+		Name:  WordRe,
+		Arity: 1,
+		Func:  complexUnary(WordRe, func(z complex128) complex128 { return complex(real(z), 0) }),
+		Help:  "real part",
+	},
+	{
+		Name:  WordIm,
+		Arity: 1,
+		Func:  complexUnary(WordIm, func(z complex128) complex128 { return complex(imag(z), 0) }),
+		Help:  "imaginary part",
+	},
+	{
+		Name:  WordConj,
+		Arity: 1,
+		Func:  complexUnary(WordConj, cmplx.Conj),
+		Help:  "complex conjugate",
+	},
+	{
+		Name:  WordArg,
+		Arity: 1,
+		Func:  complexUnary(WordArg, func(z complex128) complex128 { return complex(cmplx.Phase(z), 0) }),
+		Help:  "argument in radians",
+	},
+}
@@ -0,0 +1,167 @@
+package rpn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/azr4e1/polacco/rpn"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestComplexBackend_ComputesWithComplexNumbers(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input  string
+		Output []string
+	}
+	testCases := []TestCase{
+		{
+			Input:  "3+4i abs",
+			Output: []string{"5"},
+		},
+		{
+			Input:  "(3,4) 1-2i +",
+			Output: []string{"4+2i"},
+		},
+		{
+			Input:  "( 3 , -4 )",
+			Output: []string{"3-4i"},
+		},
+		{
+			Input:  "0 1 - sqrt",
+			Output: []string{"1i"},
+		},
+		{
+			Input:  "2i 2i *",
+			Output: []string{"-4"},
+		},
+		{
+			Input:  "0 4 - 0.5 ^ abs",
+			Output: []string{"2"},
+		},
+		{
+			Input:  "3 4 r->c",
+			Output: []string{"3+4i"},
+		},
+		{
+			Input:  "3+4i c->r",
+			Output: []string{"3", "4"},
+		},
+		{
+			Input:  "3+4i dup re swap im",
+			Output: []string{"3", "4"},
+		},
+		{
+			Input:  "3+4i conj",
+			Output: []string{"3-4i"},
+		},
+		{
+			Input:  "1i arg 2 *",
+			Output: []string{"3.141592653589793"},
+		},
+		{
+			Input:  "2 3 ^ 16 sqrt",
+			Output: []string{"8", "4"},
+		},
+		{
+			Input:  "1+1i 1-1i /",
+			Output: []string{"1i"},
+		},
+		{
+			Input:  "7 2 idiv 7 2 mod",
+			Output: []string{"3", "1"},
+		},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStackWithBackend(rpn.ComplexBackend)
+		err := rpn.StringParser(stack, tc.Input)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Input, err)
+		}
+
+		got := stack.Strings()
+		if !cmp.Equal(tc.Output, got) {
+			t.Errorf("%s: %s", tc.Input, cmp.Diff(tc.Output, got))
+		}
+	}
+}
+
+func TestComplexBackend_ReturnsErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []string{
+		"1 0 /",
+		"0 0 ^",
+		"0 ln",
+		"0 inv",
+		"1 r->c",
+	}
+	for _, input := range testCases {
+		stack := rpn.NewStackWithBackend(rpn.ComplexBackend)
+		err := rpn.StringParser(stack, input)
+		if err == nil {
+			t.Errorf("want error, got nil for test case '%s'", input)
+		}
+	}
+}
+
+func TestComplexBackend_RejectsComplexOperandsOfIntegerDivision(t *testing.T) {
+	t.Parallel()
+	testCases := []string{
+		"3+4i 2 idiv",
+		"7 2i idiv",
+		"3+4i 2 mod",
+		"7 2i mod",
+	}
+	for _, input := range testCases {
+		stack := rpn.NewStackWithBackend(rpn.ComplexBackend)
+		err := rpn.StringParser(stack, input)
+		var domainErr *rpn.DomainError
+		if !errors.As(err, &domainErr) {
+			t.Errorf("%s: want a domain error, got %v", input, err)
+		}
+	}
+}
+
+func TestRPNComplex_RequiresTheComplexBackend(t *testing.T) {
+	t.Parallel()
+	testCases := []string{
+		"3+4i",
+		"(3,4)",
+		"2i",
+		"1 2 r->c",
+		"1 re",
+	}
+	for _, input := range testCases {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, input)
+		if err == nil {
+			t.Errorf("want error, got nil for test case '%s'", input)
+		}
+	}
+}
+
+func TestRPNScannerScan_EmitsComplexLiterals(t *testing.T) {
+	t.Parallel()
+	scanner := rpn.NewRPNScanner("3+4i 2.5i (1,-2) 3 4+5")
+	want := []rpn.RPNElement{
+		rpn.RPNComplex(3 + 4i),
+		rpn.RPNComplex(2.5i),
+		rpn.RPNComplex(1 - 2i),
+		rpn.RPNLiteral("3"),
+		rpn.RPNLiteral("4"),
+		rpn.RPNOperation("+"),
+		rpn.RPNLiteral("5"),
+	}
+	got := []rpn.RPNElement{}
+	for scanner.Scan() {
+		token, err := scanner.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, token)
+	}
+
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
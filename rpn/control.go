@@ -0,0 +1,403 @@
+package rpn
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// Comparison operators. They push 1 if the comparison holds and 0
+// otherwise.
+const (
+	OperationLess         = "<"
+	OperationGreater      = ">"
+	OperationEqual        = "="
+	OperationLessEqual    = "<="
+	OperationGreaterEqual = ">="
+	OperationNotEqual     = "!="
+)
+
+// Control words. They are handled by the scanner, which turns each
+// structure into a single token.
+const (
+	WordIf    = "if"
+	WordElse  = "else"
+	WordThen  = "then"
+	WordDo    = "do"
+	WordLoop  = "loop"
+	WordBegin = "begin"
+	WordUntil = "until"
+)
+
+// Loop index words.
+const (
+	WordIndex      = "i"
+	WordOuterIndex = "j"
+)
+
+// DefaultStepLimit is how many tokens a single evaluation can apply before
+// it fails, so that runaway loops end with an error.
+const DefaultStepLimit = 1000000
+
+var controlWords = []string{WordIf, WordElse, WordThen, WordDo, WordLoop, WordBegin, WordUntil}
+
+// step is a token together with its text and offset in the expression it
+// was scanned from.
+type step struct {
+	token  RPNElement
+	text   string
+	offset int
+}
+
+// block is a sequence of tokens, such as the body of a loop.
+type block []step
+
+func (b block) apply(s *RPNStack) error {
+	for _, st := range b {
+		if err := s.step(); err != nil {
+			return locate(err, st.text, st.offset)
+		}
+		if err := st.token.Apply(s); err != nil {
+			return locate(err, st.text, st.offset)
+		}
+	}
+
+	return nil
+}
+
+// RPNIf is an if … else … then structure. It pops the top of the stack and
+// applies Then if it is not zero, and Else otherwise.
+type RPNIf struct {
+	Then block
+	Else block
+}
+
+func (c RPNIf) Apply(s *RPNStack) error {
+	val, err := s.PopNumber()
+	if err != nil {
+		return opError(WordIf, err)
+	}
+	if s.isTrue(val) {
+		return c.Then.apply(s)
+	}
+
+	return c.Else.apply(s)
+}
+
+// RPNDoLoop is a limit start do … loop structure. It applies Body once for
+// each index from start up to, but excluding, limit; the word i pushes the
+// current index, and j the index of the enclosing loop.
+type RPNDoLoop struct {
+	Body block
+}
+
+func (c RPNDoLoop) Apply(s *RPNStack) error {
+	length := len(s.values)
+	if length < 2 {
+		return &StackUnderflowError{Op: WordDo, Required: 2, Available: length}
+	}
+	limit, start := s.backend.Float64(s.values[length-2]), s.backend.Float64(s.values[length-1])
+	if limit != math.Trunc(limit) || start != math.Trunc(start) {
+		return &DomainError{Op: WordDo, Err: errors.New("loop bounds must be integers")}
+	}
+	s.values = s.values[:length-2]
+
+	s.loops = append(s.loops, int64(start))
+	defer func() { s.loops = s.loops[:len(s.loops)-1] }()
+	for ; s.loops[len(s.loops)-1] < int64(limit); s.loops[len(s.loops)-1]++ {
+		// every iteration counts, so that loops with an empty body end too
+		if err := s.step(); err != nil {
+			return err
+		}
+		if err := c.Body.apply(s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RPNBeginUntil is a begin … until structure. It applies Body, then pops
+// the top of the stack, until the popped value is not zero.
+type RPNBeginUntil struct {
+	Body block
+}
+
+func (c RPNBeginUntil) Apply(s *RPNStack) error {
+	for {
+		if err := s.step(); err != nil {
+			return err
+		}
+		if err := c.Body.apply(s); err != nil {
+			return err
+		}
+		val, err := s.PopNumber()
+		if err != nil {
+			return opError(WordUntil, err)
+		}
+		if s.isTrue(val) {
+			return nil
+		}
+	}
+}
+
+// SetStepLimit sets how many tokens a single evaluation can apply; a limit
+// of 0 or less restores DefaultStepLimit.
+func (r *RPNStack) SetStepLimit(limit int) {
+	r.stepLimit = limit
+}
+
+// step counts a token applied by the current evaluation.
+func (r *RPNStack) step() error {
+	limit := r.stepLimit
+	if limit <= 0 {
+		limit = DefaultStepLimit
+	}
+	r.steps++
+	if r.steps > limit {
+		return &DomainError{Err: fmt.Errorf("step limit of %d exceeded", limit)}
+	}
+
+	return nil
+}
+
+func (r *RPNStack) isTrue(val Number) bool {
+	if c, ok := r.backend.(ComplexConverter); ok {
+		return c.Complex(val) != 0
+	}
+
+	return r.backend.Float64(val) != 0
+}
+
+// loopIndex builds the word that pushes the index of the loop depth levels
+// out from the innermost one.
+func loopIndex(name string, depth int) func(*RPNStack) error {
+	return func(s *RPNStack) error {
+		if len(s.loops) <= depth {
+			return fmt.Errorf("%s can only be used inside %d nested do loops", name, depth+1)
+		}
+		s.PushNumber(s.backend.FromFloat(float64(s.loops[len(s.loops)-1-depth])))
+		return nil
+	}
+}
+
+// compare returns -1, 0 or 1 as x is less than, equal to or greater than
+// y, comparing exactly when the backend stores them as big numbers. It
+// reports false if x and y are unordered, such as when either is NaN, and
+// fails when ordering complex numbers.
+func compare(b Backend, x, y Number, ordered bool) (int, bool, error) {
+	switch x := x.(type) {
+	case *big.Float:
+		if y, ok := y.(*big.Float); ok {
+			return x.Cmp(y), true, nil
+		}
+	case *big.Rat:
+		if y, ok := y.(*big.Rat); ok {
+			return x.Cmp(y), true, nil
+		}
+	case complex128:
+		y := y.(complex128)
+		if x == y {
+			return 0, true, nil
+		}
+		if ordered && (imag(x) != 0 || imag(y) != 0) {
+			return 0, false, errors.New("cannot order complex numbers")
+		}
+		if imag(x) != imag(y) {
+			return 0, false, nil
+		}
+	}
+
+	xf, yf := b.Float64(x), b.Float64(y)
+	switch {
+	case xf < yf:
+		return -1, true, nil
+	case xf > yf:
+		return 1, true, nil
+	case xf == yf:
+		return 0, true, nil
+	}
+
+	return 0, false, nil
+}
+
+// comparison builds a comparison operator that holds for the results of
+// compare accepted by holds; unordered values only satisfy !=.
+func comparison(name string, holds func(c int) bool) func(*RPNStack) error {
+	ordered := name != OperationEqual && name != OperationNotEqual
+	return func(s *RPNStack) error {
+		return s.binary(func(x, y Number) (Number, error) {
+			c, ok, err := compare(s.backend, x, y, ordered)
+			if err != nil {
+				return nil, err
+			}
+			if ok && holds(c) || !ok && name == OperationNotEqual {
+				return s.backend.FromFloat(1), nil
+			}
+			return s.backend.FromFloat(0), nil
+		})
+	}
+}
+
+var controlOperators = []Operator{
+	{
+		Name:  OperationLess,
+		Arity: 2,
+		Func:  comparison(OperationLess, func(c int) bool { return c < 0 }),
+		Help:  "1 if the second element is less than the top, 0 otherwise",
+	},
+	{
+		Name:  OperationGreater,
+		Arity: 2,
+		Func:  comparison(OperationGreater, func(c int) bool { return c > 0 }),
+		Help:  "1 if the second element is greater than the top, 0 otherwise",
+	},
+	{
+		Name:  OperationEqual,
+		Arity: 2,
+		Func:  comparison(OperationEqual, func(c int) bool { return c == 0 }),
+		Help:  "1 if the top two elements are equal, 0 otherwise",
+	},
+	{
+		Name:  OperationLessEqual,
+		Arity: 2,
+		Func:  comparison(OperationLessEqual, func(c int) bool { return c <= 0 }),
+		Help:  "1 if the second element is at most the top, 0 otherwise",
+	},
+	{
+		Name:  OperationGreaterEqual,
+		Arity: 2,
+		Func:  comparison(OperationGreaterEqual, func(c int) bool { return c >= 0 }),
+		Help:  "1 if the second element is at least the top, 0 otherwise",
+	},
+	{
+		Name:  OperationNotEqual,
+		Arity: 2,
+		Func:  comparison(OperationNotEqual, func(c int) bool { return c != 0 }),
+		Help:  "1 if the top two elements differ, 0 otherwise",
+	},
+	{Name: WordIndex, Arity: 0, Func: loopIndex(WordIndex, 0), Help: "push the index of the innermost do loop"},
+	{Name: WordOuterIndex, Arity: 0, Func: loopIndex(WordOuterIndex, 1), Help: "push the index of the enclosing do loop"},
+}
+
+// controlWord returns the control word, or the semicolon that ends a
+// definition, found at pos, if any.
+func (s *RPNScanner) controlWord(pos int) string {
+	if pos < len(s.input) && s.input[pos] == ';' {
+		return ";"
+	}
+	end := pos
+	for end < len(s.input) && isWordChar(rune(s.input[end])) {
+		end++
+	}
+	word := strings.ToLower(s.input[pos:end])
+	for _, w := range controlWords {
+		if word == w {
+			return w
+		}
+	}
+
+	return ""
+}
+
+// scanControl scans the structure that starts with the control word at the
+// current position.
+func (s *RPNScanner) scanControl(word string) {
+	start := s.pos
+	defer func() { s.start = start }()
+	s.pos += len(word)
+
+	var err error
+	switch word {
+	case WordIf:
+		var c RPNIf
+		var end string
+		c.Then, end, err = s.scanBlock(word, start, WordElse, WordThen)
+		if err == nil && end == WordElse {
+			c.Else, _, err = s.scanBlock(word, start, WordThen)
+		}
+		s.token = c
+	case WordDo:
+		var c RPNDoLoop
+		c.Body, _, err = s.scanBlock(word, start, WordLoop)
+		s.token = c
+	case WordBegin:
+		var c RPNBeginUntil
+		c.Body, _, err = s.scanBlock(word, start, WordUntil)
+		s.token = c
+	default:
+		err = s.syntaxError("unexpected")
+	}
+
+	if err != nil {
+		s.token = nil
+		s.err = err
+	}
+}
+
+// scanBlock scans tokens up to one of the words in ends, which is consumed
+// and returned. opener is the word that started the block at start.
+func (s *RPNScanner) scanBlock(opener string, start int, ends ...string) (block, string, error) {
+	b := block{}
+	for {
+		s.skipSpace()
+		if s.pos >= len(s.input) {
+			return nil, "", &SyntaxError{Token: opener, Offset: start, Msg: "unterminated"}
+		}
+
+		if word := s.controlWord(s.pos); word != "" && word != WordIf && word != WordDo && word != WordBegin {
+			for _, end := range ends {
+				if word == end {
+					s.pos += len(word)
+					return b, word, nil
+				}
+			}
+			if word == ";" {
+				return nil, "", &SyntaxError{Token: opener, Offset: start, Msg: "unterminated"}
+			}
+			return nil, "", &SyntaxError{Token: word, Offset: s.pos, Msg: "unexpected"}
+		}
+		if s.input[s.pos] == ':' {
+			return nil, "", &SyntaxError{Token: ":", Offset: s.pos, Msg: "definitions cannot be nested"}
+		}
+
+		s.Scan()
+		token, err := s.Token()
+		if err != nil {
+			return nil, "", err
+		}
+		text, offset := s.Text()
+		b = append(b, step{token: token, text: text, offset: offset})
+	}
+}
+
+// isControlWord reports whether name is reserved by the scanner.
+func isControlWord(name string) bool {
+	for _, w := range controlWords {
+		if name == w {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unlocate forgets where err happened, so that it can be attributed to the
+// token that caused it to run, such as a user-defined word.
+func unlocate(err error) error {
+	var syntaxErr *SyntaxError
+	var underflowErr *StackUnderflowError
+	var domainErr *DomainError
+	switch {
+	case errors.As(err, &syntaxErr):
+		syntaxErr.Token, syntaxErr.Offset = "", 0
+	case errors.As(err, &underflowErr):
+		underflowErr.Token, underflowErr.Offset = "", 0
+	case errors.As(err, &domainErr):
+		domainErr.Token, domainErr.Offset = "", 0
+	}
+
+	return err
+}
@@ -0,0 +1,200 @@
+package rpn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/azr4e1/polacco/rpn"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStringParser_ComparesNumbers(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input  string
+		Output []float64
+	}
+	testCases := []TestCase{
+		{Input: "1 2 <", Output: []float64{1}},
+		{Input: "2 1 <", Output: []float64{0}},
+		{Input: "2 1 >", Output: []float64{1}},
+		{Input: "2 2 =", Output: []float64{1}},
+		{Input: "2 3 =", Output: []float64{0}},
+		{Input: "2 2 <=", Output: []float64{1}},
+		{Input: "3 2 <=", Output: []float64{0}},
+		{Input: "2 2 >=", Output: []float64{1}},
+		{Input: "2 3 !=", Output: []float64{1}},
+		{Input: "nan nan =", Output: []float64{0}},
+		{Input: "nan 1 >", Output: []float64{0}},
+		{Input: "nan 1 <", Output: []float64{0}},
+		{Input: "nan nan !=", Output: []float64{1}},
+		{Input: "-inf 1 <", Output: []float64{1}},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, tc.Input)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Input, err)
+		}
+
+		got := stack.GetValues()
+		if !cmp.Equal(tc.Output, got) {
+			t.Errorf("%s: %s", tc.Input, cmp.Diff(tc.Output, got))
+		}
+	}
+}
+
+func TestStringParser_ComparesNumbersInEveryMode(t *testing.T) {
+	t.Parallel()
+	integers, err := rpn.NewIntegerBackend(8, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type TestCase struct {
+		Backend rpn.Backend
+		Input   string
+		Output  []string
+	}
+	testCases := []TestCase{
+		{Backend: rpn.RationalBackend, Input: "1 3 / 2 6 / =", Output: []string{"1"}},
+		{Backend: rpn.RationalBackend, Input: "1 3 / 0.3333333333333333 >", Output: []string{"1"}},
+		{Backend: rpn.ComplexBackend, Input: "1+2i 1+2i = 1+2i 1 !=", Output: []string{"1", "1"}},
+		{Backend: integers, Input: "100 _100 >", Output: []string{"1"}},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStackWithBackend(tc.Backend)
+		err := rpn.StringParser(stack, tc.Input)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Input, err)
+		}
+
+		got := stack.Strings()
+		if !cmp.Equal(tc.Output, got) {
+			t.Errorf("%s: %s", tc.Input, cmp.Diff(tc.Output, got))
+		}
+	}
+
+	stack := rpn.NewStackWithBackend(rpn.ComplexBackend)
+	err = rpn.StringParser(stack, "1+2i 1 <")
+	if err == nil {
+		t.Error("want error, got nil ordering complex numbers")
+	}
+}
+
+func TestStringParser_RunsControlStructures(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input  string
+		Output []float64
+	}
+	testCases := []TestCase{
+		{Input: "_5 dup 0 < if neg then", Output: []float64{5}},
+		{Input: "5 dup 0 < if neg then", Output: []float64{5}},
+		{Input: "1 if 10 else 20 then", Output: []float64{10}},
+		{Input: "0 if 10 else 20 then", Output: []float64{20}},
+		{Input: "1 IF 0 if 1 else 2 then THEN", Output: []float64{2}},
+		{Input: "0 11 1 do i + loop", Output: []float64{55}},
+		{Input: "3 0 do i loop", Output: []float64{0, 1, 2}},
+		{Input: "0 3 do i loop", Output: []float64{}},
+		{Input: "3 1 do 3 1 do j i * loop loop", Output: []float64{1, 2, 2, 4}},
+		{Input: "1 begin 2 * dup 100 > until", Output: []float64{128}},
+		{Input: ": abs2 dup 0 < if neg then ; _3 abs2", Output: []float64{3}},
+		{Input: ": fact dup 1 > if dup 1 - fact * then ; 5 fact", Output: []float64{120}},
+		{Input: ": sum 0 swap 1 + 1 do i + loop ; 100 sum", Output: []float64{5050}},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, tc.Input)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Input, err)
+		}
+
+		got := stack.GetValues()
+		if !cmp.Equal(tc.Output, got) {
+			t.Errorf("%s: %s", tc.Input, cmp.Diff(tc.Output, got))
+		}
+	}
+}
+
+func TestStringParser_ReturnsErrorForInvalidControlStructures(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input string
+		Error string
+	}
+	testCases := []TestCase{
+		{Input: "1 if 2", Error: `unterminated "if" at offset 2`},
+		{Input: "1 2 then", Error: `unexpected "then" at offset 4`},
+		{Input: "1 if 2 loop", Error: `unexpected "loop" at offset 7`},
+		{Input: ": f if 1 ; 1 f", Error: `unterminated "if" at offset 4`},
+		{Input: "1 if : f ; then", Error: `definitions cannot be nested ":" at offset 5`},
+		{Input: "1 if 2 frob$ then", Error: `unexpected character "$" at offset 11`},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, tc.Input)
+		if err == nil {
+			t.Errorf("want error, got nil for test case '%s'", tc.Input)
+			continue
+		}
+		if err.Error() != tc.Error {
+			t.Errorf("want %s, got %s", tc.Error, err)
+		}
+	}
+
+	for _, input := range []string{"if", "1 do loop", "1.5 3 do loop", "i", "1 0 do j loop", "begin until", "'if sto"} {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, input)
+		if err == nil {
+			t.Errorf("want error, got nil for test case '%s'", input)
+		}
+	}
+}
+
+func TestStringParser_PointsAtTheFailingTokenInsideABlock(t *testing.T) {
+	t.Parallel()
+	err := rpn.StringParser(rpn.NewStack(), "1 if 1 0 / then")
+	token, offset, ok := rpn.ErrorToken(err)
+	if !ok || token != "/" || offset != 9 {
+		t.Errorf("want / at 9, got %q at %d", token, offset)
+	}
+}
+
+func TestStringParser_StopsLoopsWithAnEmptyBody(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack()
+	stack.SetStepLimit(1000)
+	err := rpn.StringParser(stack, "3000000000 0 do loop")
+
+	var domainErr *rpn.DomainError
+	if !errors.As(err, &domainErr) {
+		t.Errorf("want *rpn.DomainError, got %#v", err)
+	}
+}
+
+func TestStringParser_StopsRunawayPrograms(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack(1)
+	stack.SetStepLimit(1000)
+	err := rpn.StringParser(stack, "begin 0 until")
+
+	var domainErr *rpn.DomainError
+	if !errors.As(err, &domainErr) {
+		t.Fatalf("want *rpn.DomainError, got %#v", err)
+	}
+	want := []float64{1}
+	got := stack.GetValues()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+
+	// the limit applies to each evaluation, not to the stack
+	err = rpn.StringParser(stack, "300 0 do i drop loop")
+	if err != nil {
+		t.Error(err)
+	}
+	err = rpn.StringParser(stack, "300 0 do i drop loop")
+	if err != nil {
+		t.Error(err)
+	}
+}
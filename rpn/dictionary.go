@@ -0,0 +1,196 @@
+package rpn
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// DefaultRecursionLimit is how deeply user-defined words can call each
+// other, or themselves, before evaluation fails.
+const DefaultRecursionLimit = 256
+
+// Definition is a user-defined word, written : name source ;.
+type Definition struct {
+	Name   string
+	Source string
+}
+
+func (d Definition) String() string {
+	return fmt.Sprintf(": %s %s ;", d.Name, d.Source)
+}
+
+// compiled is a definition together with the tokens of its source.
+type compiled struct {
+	Definition
+	body block
+}
+
+// RPNDefinition is a : name source ; token. Applying it adds the word to
+// the dictionary of the stack.
+type RPNDefinition Definition
+
+func (d RPNDefinition) Apply(s *RPNStack) error {
+	return s.Define(d.Name, d.Source)
+}
+
+// Define adds the word name to the dictionary of the stack, replacing any
+// previous definition. Words in source are looked up when name is run, so
+// a word can call words defined after it, and itself.
+func (r *RPNStack) Define(name, source string) error {
+	name = strings.ToLower(name)
+	if r.isReserved(name) {
+		return fmt.Errorf("%q is a reserved name", name)
+	}
+	if !isVariableName(name) {
+		return fmt.Errorf("cannot define %q", name)
+	}
+
+	source = strings.Join(strings.Fields(uncomment(source)), " ")
+	body := block{}
+	scanner := NewRPNScanner(source)
+	for scanner.Scan() {
+		token, err := scanner.Token()
+		if err != nil {
+			return err
+		}
+		if _, ok := token.(RPNDefinition); ok {
+			return errors.New("definitions cannot be nested")
+		}
+		text, offset := scanner.Text()
+		body = append(body, step{token: token, text: text, offset: offset})
+	}
+
+	// words are copied on write so that snapshots can share them
+	words := make(map[string]compiled, len(r.words)+1)
+	for n, w := range r.words {
+		words[n] = w
+	}
+	words[name] = compiled{Definition: Definition{Name: name, Source: source}, body: body}
+	r.words = words
+
+	return nil
+}
+
+// Forget removes the word name from the dictionary of the stack.
+func (r *RPNStack) Forget(name string) error {
+	name = strings.ToLower(name)
+	if _, ok := r.words[name]; !ok {
+		return fmt.Errorf("%s is not defined", name)
+	}
+
+	words := make(map[string]compiled, len(r.words))
+	for n, w := range r.words {
+		if n != name {
+			words[n] = w
+		}
+	}
+	r.words = words
+
+	return nil
+}
+
+// Definitions returns the user-defined words sorted by name.
+func (r *RPNStack) Definitions() []Definition {
+	defs := make([]Definition, 0, len(r.words))
+	for _, w := range r.words {
+		defs = append(defs, w.Definition)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+
+	return defs
+}
+
+// Word returns the user-defined word name.
+func (r *RPNStack) Word(name string) (Definition, bool) {
+	w, ok := r.words[strings.ToLower(name)]
+	return w.Definition, ok
+}
+
+// SetRecursionLimit sets how deeply user-defined words can be nested; a
+// limit of 0 or less restores DefaultRecursionLimit.
+func (r *RPNStack) SetRecursionLimit(limit int) {
+	r.recursionLimit = limit
+}
+
+// run applies the body of the user-defined word w.
+func (r *RPNStack) run(w compiled) error {
+	limit := r.recursionLimit
+	if limit <= 0 {
+		limit = DefaultRecursionLimit
+	}
+	if r.calls >= limit {
+		return &DomainError{Op: w.Name, Err: fmt.Errorf("recursion limit of %d exceeded", limit)}
+	}
+
+	r.calls++
+	defer func() { r.calls-- }()
+	if err := w.body.apply(r); err != nil {
+		// offsets in the body are relative to the definition, so the error
+		// is reported at the word that was run
+		return unlocate(err)
+	}
+
+	return nil
+}
+
+// scanDefinition scans a definition, from the colon that starts it to the
+// semicolon that ends it.
+func (s *RPNScanner) scanDefinition() {
+	start := s.pos
+	defer func() { s.start = start }()
+
+	s.pos++
+	s.skipSpace()
+	nameStart := s.pos
+	for s.pos < len(s.input) && isWordChar(rune(s.input[s.pos])) {
+		s.pos++
+	}
+	name := s.input[nameStart:s.pos]
+	if name == "" || !unicode.IsLetter(rune(name[0])) {
+		s.token = nil
+		s.err = &SyntaxError{Token: ":", Offset: start, Msg: "expected a name after"}
+		return
+	}
+
+	bodyStart := s.pos
+	if _, _, err := s.scanBlock(":", start, ";"); err != nil {
+		s.token = nil
+		s.err = err
+		return
+	}
+
+	source := s.input[bodyStart : s.pos-1]
+	s.token = RPNDefinition{Name: strings.ToLower(name), Source: strings.Join(strings.Fields(uncomment(source)), " ")}
+}
+
+// skipSpace skips separators and comments.
+func (s *RPNScanner) skipSpace() {
+	for s.pos < len(s.input) {
+		if isSeparator(rune(s.input[s.pos])) {
+			s.pos++
+			continue
+		}
+		end, ok := s.commentEnd(s.pos)
+		if !ok || end == s.pos {
+			return
+		}
+		s.pos = end
+	}
+}
+
+func equalWords(words1, words2 map[string]compiled) bool {
+	if len(words1) != len(words2) {
+		return false
+	}
+	for name, w := range words1 {
+		other, ok := words2[name]
+		if !ok || w.Source != other.Source {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,166 @@
+package rpn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/azr4e1/polacco/rpn"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStringParser_AppliesUserDefinedWords(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input  string
+		Output []float64
+	}
+	testCases := []TestCase{
+		{Input: ": hyp dup * swap dup * + sqrt ; 3 4 hyp", Output: []float64{5}},
+		{Input: ": vat 1.2 * ; 100 vat", Output: []float64{120}},
+		{Input: ": sq dup * ; : cube dup sq * ; 3 cube", Output: []float64{27}},
+		{Input: ": a b 1 + ; : b 2 ; a", Output: []float64{3}},
+		{Input: ": sq dup * ; : sq 2 * ; 5 sq", Output: []float64{10}},
+		{Input: ": SQ dup * ; 5 sq", Output: []float64{25}},
+		{Input: ":sq dup*; 4 sq", Output: []float64{16}},
+		{Input: ": keep 'k sto ; 7 keep k", Output: []float64{7}},
+		{Input: ": noop ; 1 noop", Output: []float64{1}},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, tc.Input)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Input, err)
+		}
+
+		got := stack.GetValues()
+		if !approxEqStack(tc.Output, got) {
+			t.Errorf("%s: %s", tc.Input, cmp.Diff(tc.Output, got))
+		}
+	}
+}
+
+func TestStringParser_ReturnsErrorForInvalidDefinitions(t *testing.T) {
+	t.Parallel()
+	testCases := []string{
+		": sq dup *",
+		":",
+		": ;",
+		": 2x dup ;",
+		": dup dup ;",
+		": inf 1 ;",
+		": a : b ; ;",
+		": sq dup frob$ ;",
+		";",
+	}
+	for _, input := range testCases {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, input)
+		if err == nil {
+			t.Errorf("want error, got nil for test case '%s'", input)
+		}
+		if got := stack.Definitions(); len(got) != 0 {
+			t.Errorf("%s: want no definitions, got %v", input, got)
+		}
+	}
+}
+
+func TestStringParser_LimitsRecursion(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack(1)
+	stack.SetRecursionLimit(10)
+	err := rpn.StringParser(stack, ": spin 1 + spin ; spin")
+
+	var domainErr *rpn.DomainError
+	if !errors.As(err, &domainErr) {
+		t.Fatalf("want *rpn.DomainError, got %#v", err)
+	}
+	if domainErr.Op != "spin" || domainErr.Token != "spin" || domainErr.Offset != 18 {
+		t.Errorf("want spin at offset 18, got %s %q at %d", domainErr.Op, domainErr.Token, domainErr.Offset)
+	}
+
+	want := []float64{1}
+	got := stack.GetValues()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+	if _, ok := stack.Word("spin"); ok {
+		t.Error("want the definition rolled back with the failing expression")
+	}
+}
+
+func TestRPNStackDefinitions_ListsShowsAndForgetsWords(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack()
+	err := rpn.StringParser(stack, ": sq  dup\t* ;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stack.Define("Hyp", "sq swap sq + sqrt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []rpn.Definition{
+		{Name: "hyp", Source: "sq swap sq + sqrt"},
+		{Name: "sq", Source: "dup *"},
+	}
+	got := stack.Definitions()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+
+	def, ok := stack.Word("sq")
+	if !ok || def.String() != ": sq dup * ;" {
+		t.Errorf("want : sq dup * ;, got %s", def)
+	}
+
+	if err := stack.Forget("sq"); err != nil {
+		t.Fatal(err)
+	}
+	if err := stack.Forget("sq"); err == nil {
+		t.Error("want error, got nil forgetting an undefined word")
+	}
+	if err := rpn.StringParser(stack, "3 4 hyp"); err == nil {
+		t.Error("want error, got nil for a word calling a forgotten word")
+	}
+}
+
+func TestJournal_UndoesChangesToWords(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack()
+	journal := rpn.NewJournal(stack, rpn.DefaultJournalDepth)
+	for _, exp := range []string{": sq dup * ;", ": cube dup sq * ;", ": sq dup * ;"} {
+		if err := journal.Eval(exp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := journal.Do("forget sq", func(s *rpn.RPNStack) error { return s.Forget("sq") }); err != nil {
+		t.Fatal(err)
+	}
+	type TestCase struct {
+		Step  func() (rpn.JournalEntry, error)
+		Words []string
+	}
+	testCases := []TestCase{
+		{Step: journal.Undo, Words: []string{"cube", "sq"}},
+		{Step: journal.Undo, Words: []string{"sq"}},
+		{Step: journal.Redo, Words: []string{"cube", "sq"}},
+		{Step: journal.Redo, Words: []string{"cube"}},
+	}
+	for i, tc := range testCases {
+		if _, err := tc.Step(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		got := []string{}
+		for _, def := range stack.Definitions() {
+			got = append(got, def.Name)
+		}
+		if !cmp.Equal(tc.Words, got) {
+			t.Errorf("step %d: %s", i, cmp.Diff(tc.Words, got))
+		}
+	}
+	// redefining sq with the same source is not recorded
+	if got := len(journal.Entries()); got != 3 {
+		t.Errorf("want 3 entries, got %d", got)
+	}
+}
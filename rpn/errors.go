@@ -0,0 +1,132 @@
+package rpn
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SyntaxError reports a token that cannot be read, such as an unknown word
+// or a malformed number. Offset is the byte offset of Token in the
+// expression.
+type SyntaxError struct {
+	Token  string
+	Offset int
+	Msg    string
+	Err    error
+}
+
+func (e *SyntaxError) Error() string {
+	msg := fmt.Sprintf("%s %q at offset %d", e.Msg, e.Token, e.Offset)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+
+	return msg
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// StackUnderflowError reports an operator that needs more elements than
+// the stack holds.
+type StackUnderflowError struct {
+	Op        string
+	Token     string
+	Offset    int
+	Required  int
+	Available int
+}
+
+func (e *StackUnderflowError) Error() string {
+	if e.Op == "" {
+		return fmt.Sprintf("not enough elements in the stack: need %d, have %d", e.Required, e.Available)
+	}
+
+	return fmt.Sprintf("not enough elements in the stack: %s needs %d, have %d", e.Op, e.Required, e.Available)
+}
+
+// DomainError reports an operator applied to values it is not defined
+// for, such as a division by zero.
+type DomainError struct {
+	Op     string
+	Token  string
+	Offset int
+	Err    error
+}
+
+func (e *DomainError) Error() string {
+	if e.Op == "" {
+		return e.Err.Error()
+	}
+
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+func (e *DomainError) Unwrap() error {
+	return e.Err
+}
+
+func underflow(required, available int) error {
+	return &StackUnderflowError{Required: required, Available: available}
+}
+
+// opError attributes err, returned by the operator name, to that operator.
+func opError(name string, err error) error {
+	var underflowErr *StackUnderflowError
+	var domainErr *DomainError
+	switch {
+	case errors.As(err, &underflowErr):
+		underflowErr.Op = name
+	case errors.As(err, &domainErr):
+		domainErr.Op = name
+	default:
+		return &DomainError{Op: name, Err: err}
+	}
+
+	return err
+}
+
+// locate records the token, found at offset in the expression, that
+// caused err, unless an inner token was already recorded.
+func locate(err error, token string, offset int) error {
+	var syntaxErr *SyntaxError
+	var underflowErr *StackUnderflowError
+	var domainErr *DomainError
+	switch {
+	case errors.As(err, &syntaxErr):
+		if syntaxErr.Token == "" {
+			syntaxErr.Token, syntaxErr.Offset = token, offset
+		}
+	case errors.As(err, &underflowErr):
+		if underflowErr.Token == "" {
+			underflowErr.Token, underflowErr.Offset = token, offset
+		}
+	case errors.As(err, &domainErr):
+		if domainErr.Token == "" {
+			domainErr.Token, domainErr.Offset = token, offset
+		}
+	default:
+		return &DomainError{Token: token, Offset: offset, Err: err}
+	}
+
+	return err
+}
+
+// ErrorToken returns the token an error returned by StringParser refers
+// to and its byte offset in the expression.
+func ErrorToken(err error) (token string, offset int, ok bool) {
+	var syntaxErr *SyntaxError
+	var underflowErr *StackUnderflowError
+	var domainErr *DomainError
+	switch {
+	case errors.As(err, &syntaxErr):
+		token, offset = syntaxErr.Token, syntaxErr.Offset
+	case errors.As(err, &underflowErr):
+		token, offset = underflowErr.Token, underflowErr.Offset
+	case errors.As(err, &domainErr):
+		token, offset = domainErr.Token, domainErr.Offset
+	}
+
+	return token, offset, token != ""
+}
@@ -0,0 +1,111 @@
+package rpn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/azr4e1/polacco/rpn"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStringParser_ReturnsSyntaxErrors(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input string
+		Want  rpn.SyntaxError
+	}
+	testCases := []TestCase{
+		{Input: "1 2 frob", Want: rpn.SyntaxError{Token: "frob", Offset: 4, Msg: "unknown word"}},
+		{Input: "1 $ +", Want: rpn.SyntaxError{Token: "$", Offset: 2, Msg: "unexpected character"}},
+		{Input: "  1.2.3", Want: rpn.SyntaxError{Token: "1.2.3", Offset: 2, Msg: "invalid number"}},
+		{Input: "0xfg", Want: rpn.SyntaxError{Token: "0xfg", Offset: 0, Msg: "invalid integer literal"}},
+	}
+	for _, tc := range testCases {
+		err := rpn.StringParser(rpn.NewStack(), tc.Input)
+		var got *rpn.SyntaxError
+		if !errors.As(err, &got) {
+			t.Errorf("%s: want *rpn.SyntaxError, got %#v", tc.Input, err)
+			continue
+		}
+		if !cmp.Equal(tc.Want, *got) {
+			t.Errorf("%s: %s", tc.Input, cmp.Diff(tc.Want, *got))
+		}
+	}
+}
+
+func TestStringParser_ReturnsStackUnderflowErrors(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input string
+		Want  rpn.StackUnderflowError
+	}
+	testCases := []TestCase{
+		{
+			Input: "3 1 2 + + +",
+			Want:  rpn.StackUnderflowError{Op: "+", Token: "+", Offset: 10, Required: 2, Available: 1},
+		},
+		{
+			Input: "sqrt",
+			Want:  rpn.StackUnderflowError{Op: "sqrt", Token: "sqrt", Offset: 0, Required: 1, Available: 0},
+		},
+		{
+			Input: "1 2 5 ROLL",
+			Want:  rpn.StackUnderflowError{Op: "roll", Token: "ROLL", Offset: 6, Required: 6, Available: 3},
+		},
+	}
+	for _, tc := range testCases {
+		err := rpn.StringParser(rpn.NewStack(), tc.Input)
+		var got *rpn.StackUnderflowError
+		if !errors.As(err, &got) {
+			t.Errorf("%s: want *rpn.StackUnderflowError, got %#v", tc.Input, err)
+			continue
+		}
+		if !cmp.Equal(tc.Want, *got) {
+			t.Errorf("%s: %s", tc.Input, cmp.Diff(tc.Want, *got))
+		}
+	}
+}
+
+func TestStringParser_ReturnsDomainErrors(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input  string
+		Op     string
+		Token  string
+		Offset int
+		Error  string
+	}
+	testCases := []TestCase{
+		{Input: "3 0 /", Op: "/", Token: "/", Offset: 4, Error: "/: cannot divide by 0"},
+		{Input: "1 _4 sqrt", Op: "sqrt", Token: "sqrt", Offset: 5, Error: "sqrt: cannot take the square root of a negative number"},
+		{Input: "1 2 and", Op: "and", Token: "and", Offset: 4, Error: "and: requires programmer mode"},
+	}
+	for _, tc := range testCases {
+		err := rpn.StringParser(rpn.NewStack(), tc.Input)
+		var got *rpn.DomainError
+		if !errors.As(err, &got) {
+			t.Errorf("%s: want *rpn.DomainError, got %#v", tc.Input, err)
+			continue
+		}
+		if got.Op != tc.Op || got.Token != tc.Token || got.Offset != tc.Offset {
+			t.Errorf("%s: want %s %q at %d, got %s %q at %d", tc.Input, tc.Op, tc.Token, tc.Offset, got.Op, got.Token, got.Offset)
+		}
+		if err.Error() != tc.Error {
+			t.Errorf("want %s, got %s", tc.Error, err)
+		}
+	}
+}
+
+func TestErrorToken_ReturnsTheFailingToken(t *testing.T) {
+	t.Parallel()
+	err := rpn.StringParser(rpn.NewStack(), "1 2 + 0 /")
+	token, offset, ok := rpn.ErrorToken(err)
+	if !ok || token != "/" || offset != 8 {
+		t.Errorf("want / at 8, got %q at %d (%t)", token, offset, ok)
+	}
+
+	_, _, ok = rpn.ErrorToken(errors.New("not positioned"))
+	if ok {
+		t.Error("want no token for a plain error")
+	}
+}
@@ -0,0 +1,3 @@
+package rpn
+
+var Unregister = unregister
@@ -0,0 +1,419 @@
+package rpn
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Programmer words.
+const (
+	WordAnd      = "and"
+	WordOr       = "or"
+	WordXor      = "xor"
+	WordNot      = "not"
+	WordShl      = "shl"
+	WordShr      = "shr"
+	WordSar      = "sar"
+	WordRol      = "rol"
+	WordRor      = "ror"
+	WordMod      = "mod"
+	WordIntDiv   = "idiv"
+	WordPopcount = "popcount"
+)
+
+// BaseFormatter is implemented by backends that can show numbers in bases
+// other than 10.
+type BaseFormatter interface {
+	FormatBase(n Number, base int) string
+}
+
+// FormatBase formats n in base if b supports it, and with b.Format
+// otherwise.
+func FormatBase(b Backend, n Number, base int) string {
+	if f, ok := b.(BaseFormatter); ok {
+		return f.FormatBase(n, base)
+	}
+
+	return b.Format(n)
+}
+
+// StringsInBase is like Strings but shows integers in base.
+func (r *RPNStack) StringsInBase(base int) []string {
+	vals := make([]string, len(r.values))
+	for i, v := range r.values {
+		vals[i] = FormatBase(r.backend, v, base)
+	}
+
+	return vals
+}
+
+type integerBackend struct {
+	bits   uint
+	signed bool
+}
+
+// NewIntegerBackend returns a backend for programmer mode. Numbers are
+// integers of the given word size, 8, 16, 32 or 64 bits, that wrap around
+// on overflow; signed integers use two's complement. Division truncates
+// towards zero, and results of functions such as sqrt are truncated.
+func NewIntegerBackend(bits uint, signed bool) (Backend, error) {
+	switch bits {
+	case 8, 16, 32, 64:
+	default:
+		return nil, fmt.Errorf("unsupported word size: %d", bits)
+	}
+
+	return integerBackend{bits: bits, signed: signed}, nil
+}
+
+func (b integerBackend) Name() string {
+	if b.signed {
+		return fmt.Sprintf("int%d", b.bits)
+	}
+
+	return fmt.Sprintf("uint%d", b.bits)
+}
+
+func (b integerBackend) wrap(x uint64) uint64 {
+	if b.bits == 64 {
+		return x
+	}
+
+	return x & (1<<b.bits - 1)
+}
+
+// int returns the value of the bit pattern x for signed backends.
+func (b integerBackend) int(x uint64) int64 {
+	shift := 64 - b.bits
+
+	return int64(x<<shift) >> shift
+}
+
+func (b integerBackend) negative(x uint64) bool {
+	return b.signed && b.int(x) < 0
+}
+
+// Parse accepts decimal integers and literals prefixed by 0x, 0o or 0b.
+// Values that do not fit in the word size wrap around.
+func (b integerBackend) Parse(literal string) (Number, error) {
+	x, ok := new(big.Int).SetString(literal, 0)
+	if !ok {
+		return nil, fmt.Errorf("programmer mode only accepts integers: %s", literal)
+	}
+
+	mask := new(big.Int).Lsh(big.NewInt(1), b.bits)
+	mask.Sub(mask, big.NewInt(1))
+
+	return new(big.Int).And(x, mask).Uint64(), nil
+}
+
+// FromFloat truncates x towards zero.
+func (b integerBackend) FromFloat(x float64) Number {
+	x = math.Trunc(x)
+	if x < 0 {
+		return b.wrap(uint64(int64(x)))
+	}
+	if x >= math.MaxUint64 {
+		return b.wrap(math.MaxUint64)
+	}
+
+	return b.wrap(uint64(x))
+}
+
+func (b integerBackend) Float64(x Number) float64 {
+	if b.signed {
+		return float64(b.int(x.(uint64)))
+	}
+
+	return float64(x.(uint64))
+}
+
+func (b integerBackend) Format(x Number) string {
+	return b.FormatBase(x, 10)
+}
+
+// FormatBase shows signed decimals with their sign, and the bit pattern of
+// the number in every other base.
+func (b integerBackend) FormatBase(x Number, base int) string {
+	val := x.(uint64)
+	if base == 10 && b.signed {
+		return strconv.FormatInt(b.int(val), 10)
+	}
+
+	digits := strconv.FormatUint(val, base)
+	switch base {
+	case 2:
+		return "0b" + digits
+	case 8:
+		return "0o" + digits
+	case 16:
+		return "0x" + strings.ToUpper(digits)
+	}
+
+	return digits
+}
+
+func (b integerBackend) Add(x, y Number) (Number, error) {
+	return b.wrap(x.(uint64) + y.(uint64)), nil
+}
+
+func (b integerBackend) Sub(x, y Number) (Number, error) {
+	return b.wrap(x.(uint64) - y.(uint64)), nil
+}
+
+func (b integerBackend) Mul(x, y Number) (Number, error) {
+	return b.wrap(x.(uint64) * y.(uint64)), nil
+}
+
+// Div truncates towards zero.
+func (b integerBackend) Div(x, y Number) (Number, error) {
+	if y.(uint64) == 0 {
+		return nil, errors.New("cannot divide by 0")
+	}
+	if b.signed {
+		return b.wrap(uint64(b.int(x.(uint64)) / b.int(y.(uint64)))), nil
+	}
+
+	return x.(uint64) / y.(uint64), nil
+}
+
+// Rem returns the remainder of Div, with the sign of x.
+func (b integerBackend) Rem(x, y Number) (Number, error) {
+	if y.(uint64) == 0 {
+		return nil, errors.New("cannot divide by 0")
+	}
+	if b.signed {
+		return b.wrap(uint64(b.int(x.(uint64)) % b.int(y.(uint64)))), nil
+	}
+
+	return x.(uint64) % y.(uint64), nil
+}
+
+func (b integerBackend) Pow(x, y Number) (Number, error) {
+	base, exp := x.(uint64), y.(uint64)
+	if base == 0 && exp == 0 {
+		return nil, checkPow(0, 0)
+	}
+	if b.negative(exp) {
+		return nil, errors.New("cannot raise an integer to a negative exponent")
+	}
+
+	result := uint64(1)
+	for ; exp != 0; exp /= 2 {
+		if exp%2 != 0 {
+			result *= base
+		}
+		base *= base
+	}
+
+	return b.wrap(result), nil
+}
+
+func (b integerBackend) Unary(name string, x Number) (Number, bool, error) {
+	val := x.(uint64)
+	switch name {
+	case FunctionNeg:
+		return b.wrap(-val), true, nil
+	case FunctionAbs:
+		if b.negative(val) {
+			return b.wrap(-val), true, nil
+		}
+		return val, true, nil
+	case FunctionFloor, FunctionCeil, FunctionRound, FunctionTrunc:
+		return val, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// IntegerDivider is implemented by backends with their own integer
+// division. Other backends truncate the float64 quotient.
+type IntegerDivider interface {
+	Div(x, y Number) (Number, error)
+	Rem(x, y Number) (Number, error)
+}
+
+func intDiv(s *RPNStack) error {
+	if b, ok := s.backend.(IntegerDivider); ok {
+		return s.binary(b.Div)
+	}
+
+	return s.binary(func(x, y Number) (Number, error) {
+		if err := checkReal(s.backend, WordIntDiv, x, y); err != nil {
+			return nil, err
+		}
+		item1, item2 := s.backend.Float64(x), s.backend.Float64(y)
+		if item2 == 0 {
+			return nil, errors.New("cannot divide by 0")
+		}
+		return s.backend.FromFloat(math.Trunc(item1 / item2)), nil
+	})
+}
+
+func mod(s *RPNStack) error {
+	if b, ok := s.backend.(IntegerDivider); ok {
+		return s.binary(b.Rem)
+	}
+
+	return s.binary(func(x, y Number) (Number, error) {
+		if err := checkReal(s.backend, WordMod, x, y); err != nil {
+			return nil, err
+		}
+		item1, item2 := s.backend.Float64(x), s.backend.Float64(y)
+		if item2 == 0 {
+			return nil, errors.New("cannot divide by 0")
+		}
+		return s.backend.FromFloat(math.Mod(item1, item2)), nil
+	})
+}
+
+// checkReal returns a DomainError for op if one of vals has an imaginary
+// part, which Float64 would drop.
+func checkReal(b Backend, op string, vals ...Number) error {
+	c, ok := b.(ComplexConverter)
+	if !ok {
+		return nil
+	}
+	for _, val := range vals {
+		if imag(c.Complex(val)) != 0 {
+			return &DomainError{Op: op, Err: errors.New("requires real numbers")}
+		}
+	}
+
+	return nil
+}
+
+// bitwise builds a binary word that only works in programmer mode.
+func bitwise(name string, f func(b integerBackend, x, y uint64) uint64) func(*RPNStack) error {
+	return func(s *RPNStack) error {
+		b, ok := s.backend.(integerBackend)
+		if !ok {
+			return &DomainError{Op: name, Err: errors.New("requires programmer mode")}
+		}
+		return s.binary(func(x, y Number) (Number, error) {
+			return b.wrap(f(b, x.(uint64), y.(uint64))), nil
+		})
+	}
+}
+
+// shift builds a word that moves the bits of the second element by the
+// number of positions on top of the stack.
+func shift(name string, f func(b integerBackend, x, n uint64) uint64) func(*RPNStack) error {
+	return func(s *RPNStack) error {
+		b, ok := s.backend.(integerBackend)
+		if !ok {
+			return &DomainError{Op: name, Err: errors.New("requires programmer mode")}
+		}
+		return s.binary(func(x, y Number) (Number, error) {
+			n := y.(uint64)
+			if b.negative(n) {
+				return nil, errors.New("cannot shift by a negative amount")
+			}
+			return b.wrap(f(b, x.(uint64), n)), nil
+		})
+	}
+}
+
+func bitwiseUnary(name string, f func(b integerBackend, x uint64) uint64) func(*RPNStack) error {
+	return func(s *RPNStack) error {
+		b, ok := s.backend.(integerBackend)
+		if !ok {
+			return &DomainError{Op: name, Err: errors.New("requires programmer mode")}
+		}
+		length := len(s.values)
+		s.values[length-1] = b.wrap(f(b, s.values[length-1].(uint64)))
+		return nil
+	}
+}
+
+func rotateLeft(b integerBackend, x, n uint64) uint64 {
+	k := n % uint64(b.bits)
+
+	return x<<k | x>>(uint64(b.bits)-k)
+}
+
+var integerWords = []Operator{
+	{
+		Name:  WordAnd,
+		Arity: 2,
+		Func:  bitwise(WordAnd, func(_ integerBackend, x, y uint64) uint64 { return x & y }),
+		Help:  "bitwise and",
+	},
+	{
+		Name:  WordOr,
+		Arity: 2,
+		Func:  bitwise(WordOr, func(_ integerBackend, x, y uint64) uint64 { return x | y }),
+		Help:  "bitwise or",
+	},
+	{
+		Name:  WordXor,
+		Arity: 2,
+		Func:  bitwise(WordXor, func(_ integerBackend, x, y uint64) uint64 { return x ^ y }),
+		Help:  "bitwise exclusive or",
+	},
+	{
+		Name:  WordNot,
+		Arity: 1,
+		Func:  bitwiseUnary(WordNot, func(_ integerBackend, x uint64) uint64 { return ^x }),
+		Help:  "bitwise complement",
+	},
+	{
+		Name:  WordShl,
+		Arity: 2,
+		Func: shift(WordShl, func(_ integerBackend, x, n uint64) uint64 {
+			if n >= 64 {
+				return 0
+			}
+			return x << n
+		}),
+		Help: "x n shl: shift left by n bits",
+	},
+	{
+		Name:  WordShr,
+		Arity: 2,
+		Func: shift(WordShr, func(_ integerBackend, x, n uint64) uint64 {
+			if n >= 64 {
+				return 0
+			}
+			return x >> n
+		}),
+		Help: "x n shr: logical shift right by n bits",
+	},
+	{
+		Name:  WordSar,
+		Arity: 2,
+		Func: shift(WordSar, func(b integerBackend, x, n uint64) uint64 {
+			return uint64(b.int(x) >> min(n, 63))
+		}),
+		Help: "x n sar: arithmetic shift right by n bits",
+	},
+	{
+		Name:  WordRol,
+		Arity: 2,
+		Func:  shift(WordRol, rotateLeft),
+		Help:  "x n rol: rotate left by n bits",
+	},
+	{
+		Name:  WordRor,
+		Arity: 2,
+		Func: shift(WordRor, func(b integerBackend, x, n uint64) uint64 {
+			return rotateLeft(b, x, uint64(b.bits)-n%uint64(b.bits))
+		}),
+		Help: "x n ror: rotate right by n bits",
+	},
+	{
+		Name:  WordPopcount,
+		Arity: 1,
+		Func: bitwiseUnary(WordPopcount, func(_ integerBackend, x uint64) uint64 {
+			return uint64(bits.OnesCount64(x))
+		}),
+		Help: "number of bits set",
+	},
+	{Name: WordMod, Arity: 2, Func: mod, Help: "remainder of the integer division"},
+	{Name: WordIntDiv, Arity: 2, Func: intDiv, Help: "integer division, truncated towards zero"},
+}
@@ -0,0 +1,164 @@
+package rpn_test
+
+import (
+	"testing"
+
+	"github.com/azr4e1/polacco/rpn"
+	"github.com/google/go-cmp/cmp"
+)
+
+func newIntegerStack(t *testing.T, bits uint, signed bool) *rpn.RPNStack {
+	t.Helper()
+	backend, err := rpn.NewIntegerBackend(bits, signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rpn.NewStackWithBackend(backend)
+}
+
+func TestIntegerBackend_WrapsOnOverflow(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Bits   uint
+		Signed bool
+		Input  string
+		Output []string
+	}
+	testCases := []TestCase{
+		{Bits: 8, Signed: false, Input: "255 1 +", Output: []string{"0"}},
+		{Bits: 8, Signed: true, Input: "127 1 +", Output: []string{"-128"}},
+		{Bits: 8, Signed: false, Input: "0 1 -", Output: []string{"255"}},
+		{Bits: 16, Signed: false, Input: "256 256 *", Output: []string{"0"}},
+		{Bits: 32, Signed: true, Input: "7 2 /", Output: []string{"3"}},
+		{Bits: 32, Signed: true, Input: "0 7 - 2 /", Output: []string{"-3"}},
+		{Bits: 32, Signed: true, Input: "0 7 - 2 mod", Output: []string{"-1"}},
+		{Bits: 32, Signed: false, Input: "17 5 idiv 17 5 mod", Output: []string{"3", "2"}},
+		{Bits: 64, Signed: false, Input: "2 64 ^", Output: []string{"0"}},
+		{Bits: 64, Signed: false, Input: "2 63 ^", Output: []string{"9223372036854775808"}},
+		{Bits: 8, Signed: false, Input: "300", Output: []string{"44"}},
+		{Bits: 64, Signed: true, Input: "17 sqrt", Output: []string{"4"}},
+	}
+	for _, tc := range testCases {
+		stack := newIntegerStack(t, tc.Bits, tc.Signed)
+		err := rpn.StringParser(stack, tc.Input)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Input, err)
+		}
+
+		got := stack.Strings()
+		if !cmp.Equal(tc.Output, got) {
+			t.Errorf("%d bits, %s: %s", tc.Bits, tc.Input, cmp.Diff(tc.Output, got))
+		}
+	}
+}
+
+func TestIntegerBackend_SupportsBitwiseWords(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input  string
+		Output []string
+	}
+	testCases := []TestCase{
+		{Input: "0xf0 0x3c and", Output: []string{"0x30"}},
+		{Input: "0xf0 0x0f or", Output: []string{"0xFF"}},
+		{Input: "0xff 0x0f xor", Output: []string{"0xF0"}},
+		{Input: "0x0f not", Output: []string{"0xF0"}},
+		{Input: "0b0001 3 shl", Output: []string{"0x8"}},
+		{Input: "0x81 1 shl", Output: []string{"0x2"}},
+		{Input: "0x80 7 shr", Output: []string{"0x1"}},
+		{Input: "0x80 7 sar", Output: []string{"0xFF"}},
+		{Input: "0x81 1 rol", Output: []string{"0x3"}},
+		{Input: "0x81 1 ror", Output: []string{"0xC0"}},
+		{Input: "0x81 9 ror", Output: []string{"0xC0"}},
+		{Input: "0o17 popcount", Output: []string{"0x4"}},
+		{Input: "0xff 20 shl", Output: []string{"0x0"}},
+	}
+	for _, tc := range testCases {
+		stack := newIntegerStack(t, 8, false)
+		err := rpn.StringParser(stack, tc.Input)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Input, err)
+		}
+
+		got := stack.StringsInBase(16)
+		if !cmp.Equal(tc.Output, got) {
+			t.Errorf("%s: %s", tc.Input, cmp.Diff(tc.Output, got))
+		}
+	}
+}
+
+func TestIntegerBackend_FormatsInEveryBase(t *testing.T) {
+	t.Parallel()
+	stack := newIntegerStack(t, 8, true)
+	err := rpn.StringParser(stack, "0 6 -")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int]string{2: "0b11111010", 8: "0o372", 10: "-6", 16: "0xFA"}
+	for base, s := range want {
+		got := stack.StringsInBase(base)
+		if !cmp.Equal([]string{s}, got) {
+			t.Errorf("base %d: %s", base, cmp.Diff([]string{s}, got))
+		}
+	}
+}
+
+func TestIntegerBackend_ReturnsErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []string{
+		"1.5",
+		"1 0 /",
+		"1 0 mod",
+		"0 0 ^",
+		"2 0 1 - ^",
+		"1 0 1 - shl",
+	}
+	for _, input := range testCases {
+		stack := newIntegerStack(t, 32, true)
+		err := rpn.StringParser(stack, input)
+		if err == nil {
+			t.Errorf("want error, got nil for test case '%s'", input)
+		}
+	}
+}
+
+func TestNewIntegerBackend_ReturnsErrorForUnsupportedWordSizes(t *testing.T) {
+	t.Parallel()
+	_, err := rpn.NewIntegerBackend(12, false)
+	if err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestBitwiseWords_RequireProgrammerMode(t *testing.T) {
+	t.Parallel()
+	for _, input := range []string{"1 2 and", "1 not", "1 2 shl", "3 popcount"} {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, input)
+		if err == nil {
+			t.Errorf("want error, got nil for test case '%s'", input)
+		}
+	}
+}
+
+func TestStringParser_ReadsBasedLiteralsInEveryMode(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack()
+	err := rpn.StringParser(stack, "0xff 0o17 0b101 7.5 2 mod 7.5 2 idiv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []float64{255, 15, 5, 1.5, 3}
+	got := stack.GetValues()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+
+	err = rpn.StringParser(stack, "0xfg")
+	if err == nil {
+		t.Error("want error, got nil for invalid literal")
+	}
+}
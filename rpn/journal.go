@@ -0,0 +1,130 @@
+package rpn
+
+import (
+	"errors"
+)
+
+const DefaultJournalDepth = 100
+
+// JournalEntry records the stack, the variables and the user-defined words
+// before and after an expression was applied.
+type JournalEntry struct {
+	Expression      string
+	Before          []Number
+	After           []Number
+	BeforeVariables map[string]Number
+	AfterVariables  map[string]Number
+
+	// the dictionaries are copied on write, so they can be shared
+	beforeWords map[string]compiled
+	afterWords  map[string]compiled
+}
+
+// Journal wraps a stack and keeps an undo/redo history of the changes made
+// through it, including changes to its variables and words. At most depth entries
+// are kept; older ones are discarded.
+type Journal struct {
+	stack *RPNStack
+	depth int
+	undo  []JournalEntry
+	redo  []JournalEntry
+}
+
+func NewJournal(stack *RPNStack, depth int) *Journal {
+	return &Journal{stack: stack, depth: max(depth, 0)}
+}
+
+func (j *Journal) Stack() *RPNStack {
+	return j.stack
+}
+
+// Do applies f to the stack and records the change under the name exp.
+// Nothing is recorded if f fails or leaves the stack unchanged.
+func (j *Journal) Do(exp string, f func(*RPNStack) error) error {
+	before := j.stack.snapshot()
+	if err := f(j.stack); err != nil {
+		return err
+	}
+
+	after := j.stack.snapshot()
+	if equalValues(before.values, after.values) && equalVariables(before.vars, after.vars) && equalWords(before.words, after.words) {
+		return nil
+	}
+
+	j.redo = nil
+	j.undo = append(j.undo, JournalEntry{
+		Expression:      exp,
+		Before:          before.values,
+		After:           after.values,
+		BeforeVariables: before.vars,
+		AfterVariables:  after.vars,
+		beforeWords:     before.words,
+		afterWords:      after.words,
+	})
+	j.undo = j.undo[max(0, len(j.undo)-j.depth):]
+
+	return nil
+}
+
+// Eval evaluates exp with StringParser and records it.
+func (j *Journal) Eval(exp string) error {
+	return j.Do(exp, func(s *RPNStack) error {
+		return StringParser(s, exp)
+	})
+}
+
+// Undo brings the stack back to the state it had before the last recorded
+// change, and returns that change.
+func (j *Journal) Undo() (JournalEntry, error) {
+	if len(j.undo) == 0 {
+		return JournalEntry{}, errors.New("nothing to undo")
+	}
+
+	entry := j.undo[len(j.undo)-1]
+	j.undo = j.undo[:len(j.undo)-1]
+	j.redo = append(j.redo, entry)
+	j.stack.restore(state{copyValues(entry.Before), copyVariables(entry.BeforeVariables), entry.beforeWords})
+
+	return entry, nil
+}
+
+// Redo reapplies the last undone change, and returns it.
+func (j *Journal) Redo() (JournalEntry, error) {
+	if len(j.redo) == 0 {
+		return JournalEntry{}, errors.New("nothing to redo")
+	}
+
+	entry := j.redo[len(j.redo)-1]
+	j.redo = j.redo[:len(j.redo)-1]
+	j.undo = append(j.undo, entry)
+	j.stack.restore(state{copyValues(entry.After), copyVariables(entry.AfterVariables), entry.afterWords})
+
+	return entry, nil
+}
+
+func (j *Journal) Entries() []JournalEntry {
+	entries := make([]JournalEntry, len(j.undo))
+	copy(entries, j.undo)
+
+	return entries
+}
+
+func copyValues(vals []Number) []Number {
+	c := make([]Number, len(vals))
+	copy(c, vals)
+
+	return c
+}
+
+func equalValues(vals1, vals2 []Number) bool {
+	if len(vals1) != len(vals2) {
+		return false
+	}
+	for i := range vals1 {
+		if !sameNumber(vals1[i], vals2[i]) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,112 @@
+package rpn_test
+
+import (
+	"testing"
+
+	"github.com/azr4e1/polacco/rpn"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestJournal_UndoesAndRedoesExpressions(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack()
+	journal := rpn.NewJournal(stack, rpn.DefaultJournalDepth)
+	for _, exp := range []string{"1 2", "3 *", "dup +"} {
+		if err := journal.Eval(exp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entry, err := journal.Undo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Expression != "dup +" {
+		t.Errorf("want to undo 'dup +', got '%s'", entry.Expression)
+	}
+	want := []float64{1, 6}
+	got := stack.GetValues()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+
+	_, err = journal.Undo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []float64{1, 2}
+	got = stack.GetValues()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+
+	_, err = journal.Redo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []float64{1, 6}
+	got = stack.GetValues()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestJournal_NewChangesDiscardTheRedoHistory(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack()
+	journal := rpn.NewJournal(stack, rpn.DefaultJournalDepth)
+	if err := journal.Eval("1 2 +"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := journal.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.Eval("5"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := journal.Redo()
+	if err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestJournal_DoesNotRecordFailures(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack()
+	journal := rpn.NewJournal(stack, rpn.DefaultJournalDepth)
+	if err := journal.Eval("1 0 /"); err == nil {
+		t.Fatal("want error, got nil")
+	}
+
+	_, err := journal.Undo()
+	if err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestJournal_KeepsAtMostDepthEntries(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack()
+	journal := rpn.NewJournal(stack, 2)
+	for _, exp := range []string{"1", "2", "3"} {
+		if err := journal.Eval(exp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := journal.Undo(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := journal.Undo(); err == nil {
+		t.Error("want error, got nil")
+	}
+
+	want := []float64{1}
+	got := stack.GetValues()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
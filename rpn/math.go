@@ -0,0 +1,161 @@
+package rpn
+
+import (
+	"errors"
+	"math"
+)
+
+// Named unary functions. Trigonometric functions work in radians.
+const (
+	FunctionSqrt  = "sqrt"
+	FunctionCbrt  = "cbrt"
+	FunctionLn    = "ln"
+	FunctionLog   = "log"
+	FunctionLog10 = "log10"
+	FunctionLog2  = "log2"
+	FunctionExp   = "exp"
+	FunctionSin   = "sin"
+	FunctionCos   = "cos"
+	FunctionTan   = "tan"
+	FunctionAsin  = "asin"
+	FunctionAcos  = "acos"
+	FunctionAtan  = "atan"
+	FunctionSinh  = "sinh"
+	FunctionCosh  = "cosh"
+	FunctionTanh  = "tanh"
+	FunctionAsinh = "asinh"
+	FunctionAcosh = "acosh"
+	FunctionAtanh = "atanh"
+	FunctionAbs   = "abs"
+	FunctionNeg   = "neg"
+	FunctionInv   = "inv"
+	FunctionFloor = "floor"
+	FunctionCeil  = "ceil"
+	FunctionRound = "round"
+	FunctionTrunc = "trunc"
+)
+
+type UnaryFunction func(float64) (float64, error)
+
+func total(f func(float64) float64) UnaryFunction {
+	return func(x float64) (float64, error) {
+		return f(x), nil
+	}
+}
+
+func logarithm(f func(float64) float64) UnaryFunction {
+	return func(x float64) (float64, error) {
+		if x <= 0 {
+			return 0, errors.New("cannot take the logarithm of a non-positive number")
+		}
+		return f(x), nil
+	}
+}
+
+func unitInterval(f func(float64) float64) UnaryFunction {
+	return func(x float64) (float64, error) {
+		if x < -1 || x > 1 {
+			return 0, errors.New("argument must be between -1 and 1")
+		}
+		return f(x), nil
+	}
+}
+
+type unaryFunction struct {
+	name string
+	help string
+	f    UnaryFunction
+}
+
+var unaryFunctions = []unaryFunction{
+	{FunctionSqrt, "square root", func(x float64) (float64, error) {
+		if x < 0 {
+			return 0, errors.New("cannot take the square root of a negative number")
+		}
+		return math.Sqrt(x), nil
+	}},
+	{FunctionCbrt, "cube root", total(math.Cbrt)},
+	{FunctionLn, "natural logarithm", logarithm(math.Log)},
+	{FunctionLog, "base 10 logarithm", logarithm(math.Log10)},
+	{FunctionLog10, "base 10 logarithm", logarithm(math.Log10)},
+	{FunctionLog2, "base 2 logarithm", logarithm(math.Log2)},
+	{FunctionExp, "e raised to the top element", total(math.Exp)},
+	{FunctionSin, "sine", total(math.Sin)},
+	{FunctionCos, "cosine", total(math.Cos)},
+	{FunctionTan, "tangent", total(math.Tan)},
+	{FunctionAsin, "arcsine", unitInterval(math.Asin)},
+	{FunctionAcos, "arccosine", unitInterval(math.Acos)},
+	{FunctionAtan, "arctangent", total(math.Atan)},
+	{FunctionSinh, "hyperbolic sine", total(math.Sinh)},
+	{FunctionCosh, "hyperbolic cosine", total(math.Cosh)},
+	{FunctionTanh, "hyperbolic tangent", total(math.Tanh)},
+	{FunctionAsinh, "inverse hyperbolic sine", total(math.Asinh)},
+	{FunctionAcosh, "inverse hyperbolic cosine", func(x float64) (float64, error) {
+		if x < 1 {
+			return 0, errors.New("cannot take the inverse hyperbolic cosine of a number less than 1")
+		}
+		return math.Acosh(x), nil
+	}},
+	{FunctionAtanh, "inverse hyperbolic tangent", func(x float64) (float64, error) {
+		if x <= -1 || x >= 1 {
+			return 0, errors.New("argument must be strictly between -1 and 1")
+		}
+		return math.Atanh(x), nil
+	}},
+	{FunctionAbs, "absolute value", total(math.Abs)},
+	{FunctionNeg, "change sign", total(func(x float64) float64 { return -x })},
+	{FunctionInv, "reciprocal", func(x float64) (float64, error) {
+		if x == 0 {
+			return 0, errors.New("cannot divide by 0")
+		}
+		return 1 / x, nil
+	}},
+	{FunctionFloor, "round down", total(math.Floor)},
+	{FunctionCeil, "round up", total(math.Ceil)},
+	{FunctionRound, "round half away from zero", total(math.Round)},
+	{FunctionTrunc, "round towards zero", total(math.Trunc)},
+}
+
+// Unary replaces the top of the stack with f applied to it, computed on
+// float64 values. The stack is left untouched if f fails or its result is
+// not a finite number.
+func (r *RPNStack) Unary(f UnaryFunction) error {
+	length := len(r.values)
+	if length < 1 {
+		return underflow(1, length)
+	}
+
+	val, err := f(r.backend.Float64(r.values[length-1]))
+	if err != nil {
+		return err
+	}
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return errors.New("result is out of range")
+	}
+
+	r.values[length-1] = r.backend.FromFloat(val)
+
+	return nil
+}
+
+// unaryFunction applies the named function f, letting the backend compute
+// it natively when it can.
+func (r *RPNStack) unaryFunction(f unaryFunction) error {
+	length := len(r.values)
+	if length < 1 {
+		return underflow(1, length)
+	}
+
+	if b, ok := r.backend.(UnaryBackend); ok {
+		val, ok, err := b.Unary(f.name, r.values[length-1])
+		if err != nil {
+			return err
+		}
+		if ok {
+			r.values[length-1] = val
+			return nil
+		}
+	}
+
+	return r.Unary(f.f)
+}
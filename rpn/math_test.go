@@ -0,0 +1,99 @@
+package rpn_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/azr4e1/polacco/rpn"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStringParserFunctions_ApplyToTheTopElement(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input  string
+		Output []float64
+	}
+	testCases := []TestCase{
+		{Input: "1 16 sqrt", Output: []float64{1, 4}},
+		{Input: "27 cbrt", Output: []float64{3}},
+		{Input: "0 8 - cbrt", Output: []float64{-2}},
+		{Input: "1 ln", Output: []float64{0}},
+		{Input: "1000 log", Output: []float64{3}},
+		{Input: "100 log10", Output: []float64{2}},
+		{Input: "8 log2", Output: []float64{3}},
+		{Input: "1 exp", Output: []float64{math.E}},
+		{Input: "0 sin", Output: []float64{0}},
+		{Input: "0 cos", Output: []float64{1}},
+		{Input: "1 atan 4 * tan", Output: []float64{0}},
+		{Input: "1 asin 2 *", Output: []float64{math.Pi}},
+		{Input: "1 acos", Output: []float64{0}},
+		{Input: "1 atan 4 *", Output: []float64{math.Pi}},
+		{Input: "0 sinh", Output: []float64{0}},
+		{Input: "0 cosh", Output: []float64{1}},
+		{Input: "0 tanh", Output: []float64{0}},
+		{Input: "0 asinh", Output: []float64{0}},
+		{Input: "1 acosh", Output: []float64{0}},
+		{Input: "0 atanh", Output: []float64{0}},
+		{Input: "0 3 - abs", Output: []float64{3}},
+		{Input: "3 neg", Output: []float64{-3}},
+		{Input: "4 inv", Output: []float64{0.25}},
+		{Input: "2.7 floor", Output: []float64{2}},
+		{Input: "2.1 ceil", Output: []float64{3}},
+		{Input: "2.5 round", Output: []float64{3}},
+		{Input: "2.9 trunc", Output: []float64{2}},
+		{Input: "3 4 dup * swap dup * + sqrt", Output: []float64{5}},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, tc.Input)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Input, err)
+		}
+		want := tc.Output
+		got := stack.GetValues()
+
+		if !approxEqStack(want, got) {
+			t.Errorf("%s: %s", tc.Input, cmp.Diff(want, got))
+		}
+	}
+}
+
+func TestStringParserFunctions_ReturnErrorOutsideTheirDomain(t *testing.T) {
+	t.Parallel()
+	testCases := []string{
+		"sqrt",
+		"0 1 - sqrt",
+		"0 ln",
+		"0 1 - log10",
+		"0 log2",
+		"2 asin",
+		"0 2 - acos",
+		"0.5 acosh",
+		"1 atanh",
+		"0 inv",
+		"1000 exp",
+	}
+	for _, input := range testCases {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, input)
+		if err == nil {
+			t.Errorf("want error, got nil for test case '%s'", input)
+		}
+	}
+}
+
+func TestRPNStackUnary_LeavesTheStackUntouchedOnError(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack(1, -4)
+	err := rpn.StringParser(stack, "sqrt")
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+
+	want := []float64{1, -4}
+	got := stack.GetValues()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
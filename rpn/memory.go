@@ -0,0 +1,292 @@
+package rpn
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	WordStore    = "sto"
+	WordRecall   = "rcl"
+	WordStoreAdd = "sto+"
+	WordStoreSub = "sto-"
+)
+
+// Registers is the number of numbered registers, named 0 to Registers-1.
+const Registers = 10
+
+// RPNVariable is a bare name such as x. Applying it runs the user-defined
+// word of that name or, if there is none, pushes the value of the variable.
+type RPNVariable string
+
+func (v RPNVariable) Apply(s *RPNStack) error {
+	if w, ok := s.words[string(v)]; ok {
+		return s.run(w)
+	}
+
+	val, ok := s.vars[string(v)]
+	if !ok {
+		return &SyntaxError{Msg: "unknown word"}
+	}
+	s.PushNumber(val)
+
+	return nil
+}
+
+// RPNNamedWord is a memory word applied to a variable, written 'x sto or
+// x sto. The quote is only required when the name could be mistaken for
+// something else.
+type RPNNamedWord struct {
+	Word string
+	Name string
+}
+
+func (n RPNNamedWord) Apply(s *RPNStack) error {
+	if err := memoryWords[n.Word](s, n.Name); err != nil {
+		return opError(n.Word, err)
+	}
+
+	return nil
+}
+
+// memoryWords apply a memory word to a variable. They leave the stack and
+// the variables untouched when they fail.
+var memoryWords = map[string]func(*RPNStack, string) error{
+	WordStore:    (*RPNStack).Store,
+	WordRecall:   (*RPNStack).Recall,
+	WordStoreAdd: func(s *RPNStack, name string) error { return s.storeWith(name, s.backend.Add) },
+	WordStoreSub: func(s *RPNStack, name string) error { return s.storeWith(name, s.backend.Sub) },
+}
+
+// isVariableName reports whether name can name a variable: it must look
+// like a word and not clash with a registered operator or a special value.
+func isVariableName(name string) bool {
+	if name == "" || !unicode.IsLetter(rune(name[0])) {
+		return false
+	}
+	for _, ch := range name {
+		if !isWordChar(ch) {
+			return false
+		}
+	}
+	if _, ok := Lookup(name); ok {
+		return false
+	}
+
+	return name != "inf" && name != "nan" && !isControlWord(name)
+}
+
+func (r *RPNStack) checkVariableName(name string) error {
+	if r.isReserved(name) {
+		return fmt.Errorf("%q is a reserved name", name)
+	}
+	if isRegister(name) || isVariableName(name) {
+		return nil
+	}
+
+	return fmt.Errorf("invalid variable name %q", name)
+}
+
+// SetReserved keeps variables and user-defined words from taking the names
+// reserved reports, such as those of the commands of a front end.
+func (r *RPNStack) SetReserved(reserved func(name string) bool) {
+	r.reserved = reserved
+}
+
+func (r *RPNStack) isReserved(name string) bool {
+	return r.reserved != nil && r.reserved(name)
+}
+
+func isRegister(name string) bool {
+	n, err := strconv.Atoi(name)
+	return err == nil && strconv.Itoa(n) == name && n >= 0 && n < Registers
+}
+
+// Store pops the top of the stack into the variable or register name.
+func (r *RPNStack) Store(name string) error {
+	name = strings.ToLower(name)
+	if err := r.checkVariableName(name); err != nil {
+		return err
+	}
+	val, err := r.PopNumber()
+	if err != nil {
+		return err
+	}
+	if r.vars == nil {
+		r.vars = map[string]Number{}
+	}
+	r.vars[name] = val
+
+	return nil
+}
+
+// Recall pushes the value of the variable or register name.
+func (r *RPNStack) Recall(name string) error {
+	name = strings.ToLower(name)
+	val, ok := r.vars[name]
+	if !ok {
+		return fmt.Errorf("%s is not defined", name)
+	}
+	r.PushNumber(val)
+
+	return nil
+}
+
+// storeWith replaces the variable name with f of its value and the top of
+// the stack, which is popped. Registers start at zero.
+func (r *RPNStack) storeWith(name string, f func(Number, Number) (Number, error)) error {
+	name = strings.ToLower(name)
+	old, ok := r.vars[name]
+	if !ok && isRegister(name) {
+		old, ok = r.backend.FromFloat(0), true
+	}
+	if !ok {
+		return fmt.Errorf("%s is not defined", name)
+	}
+	length := len(r.values)
+	if length < 1 {
+		return underflow(1, length)
+	}
+	val, err := f(old, r.values[length-1])
+	if err != nil {
+		return err
+	}
+	r.values = r.values[:length-1]
+	if r.vars == nil {
+		r.vars = map[string]Number{}
+	}
+	r.vars[name] = val
+
+	return nil
+}
+
+// Variables returns a copy of the variables and registers.
+func (r *RPNStack) Variables() map[string]Number {
+	return copyVariables(r.vars)
+}
+
+// VariableNames returns the names of the defined variables and registers,
+// registers first.
+func (r *RPNStack) VariableNames() []string {
+	names := make([]string, 0, len(r.vars))
+	for name := range r.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// SetVariable sets the variable or register name to val, which must have
+// been produced by the backend of the stack.
+func (r *RPNStack) SetVariable(name string, val Number) error {
+	name = strings.ToLower(name)
+	if err := r.checkVariableName(name); err != nil {
+		return err
+	}
+	if r.vars == nil {
+		r.vars = map[string]Number{}
+	}
+	r.vars[name] = val
+
+	return nil
+}
+
+func (r *RPNStack) ClearVariables() {
+	r.vars = nil
+}
+
+// popRegister pops the top of the stack and interprets it as a register
+// number.
+func (r *RPNStack) popRegister() (string, error) {
+	length := len(r.values)
+	if length < 1 {
+		return "", underflow(1, length)
+	}
+
+	val := r.backend.Float64(r.values[length-1])
+	if val < 0 || val >= Registers || val != math.Trunc(val) {
+		return "", fmt.Errorf("register must be an integer between 0 and %d", Registers-1)
+	}
+	r.values = r.values[:length-1]
+
+	return strconv.Itoa(int(val)), nil
+}
+
+// registerWord applies the memory word name to the register whose number
+// is on top of the stack, which is put back if the word fails.
+func registerWord(name string) func(*RPNStack) error {
+	return func(s *RPNStack) error {
+		length := len(s.values)
+		if length < 1 {
+			return underflow(1, length)
+		}
+		top := s.values[length-1]
+		register, err := s.popRegister()
+		if err != nil {
+			return err
+		}
+		if err := memoryWords[name](s, register); err != nil {
+			s.PushNumber(top)
+			return err
+		}
+		return nil
+	}
+}
+
+func copyVariables(vars map[string]Number) map[string]Number {
+	if vars == nil {
+		return nil
+	}
+	c := make(map[string]Number, len(vars))
+	for name, val := range vars {
+		c[name] = val
+	}
+
+	return c
+}
+
+func equalVariables(vars1, vars2 map[string]Number) bool {
+	if len(vars1) != len(vars2) {
+		return false
+	}
+	for name, val := range vars1 {
+		other, ok := vars2[name]
+		if !ok || !sameNumber(val, other) {
+			return false
+		}
+	}
+
+	return true
+}
+
+var memoryOperators = []Operator{
+	{
+		Name:  WordStore,
+		Arity: 2,
+		Func:  registerWord(WordStore),
+		Help:  "x n sto: store x in register n; 'name sto stores in a variable",
+	},
+	{
+		Name:  WordRecall,
+		Arity: 1,
+		Func:  registerWord(WordRecall),
+		Help:  "n rcl: recall register n; 'name rcl or name recalls a variable",
+	},
+	{
+		Name:  WordStoreAdd,
+		Arity: 2,
+		Func:  registerWord(WordStoreAdd),
+		Help:  "x n sto+: add x to register n",
+	},
+	{
+		Name:  WordStoreSub,
+		Arity: 2,
+		Func:  registerWord(WordStoreSub),
+		Help:  "x n sto-: subtract x from register n",
+	},
+}
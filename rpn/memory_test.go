@@ -0,0 +1,184 @@
+package rpn_test
+
+import (
+	"testing"
+
+	"github.com/azr4e1/polacco/rpn"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStringParser_StoresAndRecallsVariables(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input  string
+		Output []float64
+	}
+	testCases := []TestCase{
+		{Input: "3 'x sto x x *", Output: []float64{9}},
+		{Input: "3 'x sto 'x rcl", Output: []float64{3}},
+		{Input: "3 x sto x rcl 1 +", Output: []float64{4}},
+		{Input: "3 'X sto x", Output: []float64{3}},
+		{Input: "2 'x sto 5 'x sto+ x", Output: []float64{7}},
+		{Input: "2 'x sto 5 'x sto- x", Output: []float64{-3}},
+		{Input: "1 'x sto 2 'y sto x y -", Output: []float64{-1}},
+		{Input: "42 0 sto 0 rcl 0 rcl +", Output: []float64{84}},
+		{Input: "5 3 sto+ 2 3 sto+ 3 rcl", Output: []float64{7}},
+		{Input: "5 9 sto- 9 rcl", Output: []float64{-5}},
+		{Input: "3 'rate sto 'rate2 rcl", Output: nil},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, tc.Input)
+		if tc.Output == nil {
+			if err == nil {
+				t.Errorf("want error, got nil for test case '%s'", tc.Input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Input, err)
+		}
+
+		got := stack.GetValues()
+		if !cmp.Equal(tc.Output, got) {
+			t.Errorf("%s: %s", tc.Input, cmp.Diff(tc.Output, got))
+		}
+	}
+}
+
+func TestStringParser_ReturnsErrorForInvalidMemoryUse(t *testing.T) {
+	t.Parallel()
+	testCases := []string{
+		"x",
+		"'x",
+		"'x +",
+		"'x sto",
+		"1 'sqrt sto",
+		"x rcl",
+		"1 'x sto+",
+		"1 10 sto",
+		"1 1.5 sto",
+		"_1 rcl",
+		"3 rcl",
+	}
+	for _, input := range testCases {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, input)
+		if err == nil {
+			t.Errorf("want error, got nil for test case '%s'", input)
+		}
+	}
+}
+
+func TestStringParser_RestoresVariablesOnError(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack()
+	err := rpn.StringParser(stack, "1 'x sto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = rpn.StringParser(stack, "2 'x sto 3 'y sto 1 0 /")
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+
+	want := []string{"x"}
+	got := stack.VariableNames()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+	if x := stack.Variables()["x"]; x != 1.0 {
+		t.Errorf("want x = 1, got %v", x)
+	}
+}
+
+func TestMemoryWords_LeaveTheStackUntouchedOnError(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Stack []float64
+		Token rpn.RPNElement
+	}
+	testCases := []TestCase{
+		{Stack: []float64{1, 3}, Token: rpn.RPNWord("rcl")},
+		{Stack: []float64{1, 12}, Token: rpn.RPNWord("sto")},
+		{Stack: []float64{1, 3}, Token: rpn.RPNNamedWord{Word: "sto+", Name: "x"}},
+		{Stack: []float64{1, 3}, Token: rpn.RPNNamedWord{Word: "rcl", Name: "x"}},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStack(tc.Stack...)
+		if err := tc.Token.Apply(stack); err == nil {
+			t.Errorf("%v: want error, got nil", tc.Token)
+		}
+		if got := stack.GetValues(); !cmp.Equal(tc.Stack, got) {
+			t.Errorf("%v: %s", tc.Token, cmp.Diff(tc.Stack, got))
+		}
+	}
+}
+
+func TestJournal_UndoesChangesToVariables(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack()
+	journal := rpn.NewJournal(stack, rpn.DefaultJournalDepth)
+	for _, exp := range []string{"1 'x sto", "5 0 sto"} {
+		if err := journal.Eval(exp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := journal.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"x"}
+	got := stack.VariableNames()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+
+	if _, err := journal.Redo(); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"0", "x"}
+	got = stack.VariableNames()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestRPNStackSetVariable_ValidatesNames(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack()
+	for _, name := range []string{"x", "Total_2", "0", "9"} {
+		if err := stack.SetVariable(name, 1.0); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "10", "2x", "dup", "inf", "a b"} {
+		if err := stack.SetVariable(name, 1.0); err == nil {
+			t.Errorf("want error, got nil for name %q", name)
+		}
+	}
+
+	stack.ClearVariables()
+	if got := stack.VariableNames(); len(got) != 0 {
+		t.Errorf("want no variables, got %v", got)
+	}
+}
+
+func TestRPNStackSetReserved_KeepsNamesFromVariablesAndWords(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack()
+	stack.SetReserved(func(name string) bool { return name == "r" || name == "hex" })
+
+	for _, expr := range []string{"7 'r sto", "7 'R sto", ": hex 16 ;"} {
+		if err := rpn.StringParser(stack, expr); err == nil {
+			t.Errorf("%q: want error, got nil", expr)
+		}
+	}
+	if err := stack.SetVariable("r", 1.0); err == nil {
+		t.Error("want error for r, got nil")
+	}
+	if err := rpn.StringParser(stack, "7 'x sto : sq dup * ;"); err != nil {
+		t.Errorf("want other names to be free, got %v", err)
+	}
+}
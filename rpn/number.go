@@ -0,0 +1,424 @@
+package rpn
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Number is a value held by the stack. Its concrete type is chosen by the
+// Backend of the stack: float64 for the default backend, *big.Float for
+// the arbitrary-precision one.
+type Number any
+
+// Backend implements the arithmetic of a stack. Backends never modify the
+// numbers they are given, so stack snapshots can share them.
+type Backend interface {
+	Name() string
+	// Parse converts a numeric literal as written in an expression.
+	Parse(literal string) (Number, error)
+	FromFloat(float64) Number
+	Float64(Number) float64
+	Format(Number) string
+
+	Add(x, y Number) (Number, error)
+	Sub(x, y Number) (Number, error)
+	Mul(x, y Number) (Number, error)
+	Div(x, y Number) (Number, error)
+	Pow(x, y Number) (Number, error)
+}
+
+// UnaryBackend is implemented by backends that compute some of the named
+// unary functions natively. For the other functions, and for backends that
+// do not implement it, the function is computed on float64 values.
+type UnaryBackend interface {
+	Unary(name string, x Number) (result Number, ok bool, err error)
+}
+
+// ParseBackend returns the backend called name, as returned by its Name
+// method: float, bigfloat, rational, complex, or a programmer mode word
+// size such as int64 or uint8.
+func ParseBackend(name string) (Backend, error) {
+	switch name = strings.ToLower(name); name {
+	case FloatBackend.Name():
+		return FloatBackend, nil
+	case "bigfloat":
+		return NewBigFloatBackend(DefaultPrecision)
+	case RationalBackend.Name():
+		return RationalBackend, nil
+	case ComplexBackend.Name():
+		return ComplexBackend, nil
+	}
+	word, signed := strings.CutPrefix(name, "int")
+	if !signed {
+		word, _ = strings.CutPrefix(name, "uint")
+	}
+	if bits, err := strconv.ParseUint(word, 10, 0); err == nil && word != name {
+		return NewIntegerBackend(uint(bits), signed)
+	}
+
+	return nil, fmt.Errorf("unknown backend: %s", name)
+}
+
+func checkPow(item1, item2 float64) error {
+	if item1 == 0 && item2 == 0 {
+		return errors.New("cannot raise 0 to the power of 0")
+	}
+	if item1 < 0 && item2-math.Trunc(item2) != 0 {
+		return errors.New("cannot raise a negative number to a fractional exponent")
+	}
+
+	return nil
+}
+
+type floatBackend struct{}
+
+// FloatBackend stores numbers as float64. It is the default backend.
+var FloatBackend Backend = floatBackend{}
+
+func (floatBackend) Name() string {
+	return "float"
+}
+
+func (floatBackend) Parse(literal string) (Number, error) {
+	return strconv.ParseFloat(literal, 64)
+}
+
+func (floatBackend) FromFloat(x float64) Number {
+	return x
+}
+
+func (floatBackend) Float64(x Number) float64 {
+	return x.(float64)
+}
+
+func (floatBackend) Format(x Number) string {
+	return fmt.Sprint(x)
+}
+
+func (floatBackend) Add(x, y Number) (Number, error) {
+	return x.(float64) + y.(float64), nil
+}
+
+func (floatBackend) Sub(x, y Number) (Number, error) {
+	return x.(float64) - y.(float64), nil
+}
+
+func (floatBackend) Mul(x, y Number) (Number, error) {
+	return x.(float64) * y.(float64), nil
+}
+
+func (floatBackend) Div(x, y Number) (Number, error) {
+	if y.(float64) == 0 {
+		return nil, errors.New("cannot divide by 0")
+	}
+
+	return x.(float64) / y.(float64), nil
+}
+
+func (floatBackend) Pow(x, y Number) (Number, error) {
+	item1, item2 := x.(float64), y.(float64)
+	if err := checkPow(item1, item2); err != nil {
+		return nil, err
+	}
+
+	return math.Pow(item1, item2), nil
+}
+
+const DefaultPrecision = 256
+
+type bigFloatBackend struct {
+	prec uint
+}
+
+// NewBigFloatBackend returns a backend that stores numbers as *big.Float
+// with prec bits of mantissa. Literals are converted from their decimal
+// text, so 0.1 0.2 + is exactly 0.3 up to the chosen precision. Functions
+// without a math/big counterpart, such as sin or fractional powers, are
+// computed with float64 precision.
+func NewBigFloatBackend(prec uint) (Backend, error) {
+	if prec == 0 || prec > big.MaxPrec {
+		return nil, fmt.Errorf("precision must be between 1 and %d bits", uint(big.MaxPrec))
+	}
+
+	return bigFloatBackend{prec: prec}, nil
+}
+
+// BigFloatPrecision returns the bits of mantissa of the numbers of b, and
+// whether b is a backend returned by NewBigFloatBackend.
+func BigFloatPrecision(b Backend) (uint, bool) {
+	if b, ok := b.(bigFloatBackend); ok {
+		return b.prec, true
+	}
+
+	return 0, false
+}
+
+func (b bigFloatBackend) Name() string {
+	return "bigfloat"
+}
+
+func (b bigFloatBackend) newFloat() *big.Float {
+	return new(big.Float).SetPrec(b.prec)
+}
+
+func (b bigFloatBackend) Parse(literal string) (Number, error) {
+	x, _, err := big.ParseFloat(literal, 10, b.prec, big.ToNearestEven)
+	if err != nil {
+		return nil, err
+	}
+	if x.IsInf() {
+		return nil, errors.New("big floats cannot be infinite")
+	}
+
+	return x, nil
+}
+
+func (b bigFloatBackend) FromFloat(x float64) Number {
+	return b.newFloat().SetFloat64(x)
+}
+
+func (b bigFloatBackend) Float64(x Number) float64 {
+	f, _ := x.(*big.Float).Float64()
+
+	return f
+}
+
+// Format prints two digits less than the precision can hold, so that the
+// rounding of binary fractions such as 0.1 does not show.
+func (b bigFloatBackend) Format(x Number) string {
+	digits := max(1, int(float64(b.prec)*math.Log10(2))-2)
+
+	return x.(*big.Float).Text('g', digits)
+}
+
+// checkBig returns the result of f, which computes with big floats. Their
+// exponent is bounded, so results can overflow to infinity, and the
+// operations of math/big panic with big.ErrNaN rather than produce NaN.
+// Both are reported as errors.
+func checkBig(f func() (*big.Float, error)) (n Number, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(big.ErrNaN); !ok {
+				panic(r)
+			}
+			n, err = nil, errors.New("result is not a number")
+		}
+	}()
+
+	x, err := f()
+	if err != nil {
+		return nil, err
+	}
+	if x.IsInf() {
+		return nil, errors.New("result is out of range")
+	}
+
+	return x, nil
+}
+
+func (b bigFloatBackend) Add(x, y Number) (Number, error) {
+	return checkBig(func() (*big.Float, error) {
+		return b.newFloat().Add(x.(*big.Float), y.(*big.Float)), nil
+	})
+}
+
+func (b bigFloatBackend) Sub(x, y Number) (Number, error) {
+	return checkBig(func() (*big.Float, error) {
+		return b.newFloat().Sub(x.(*big.Float), y.(*big.Float)), nil
+	})
+}
+
+func (b bigFloatBackend) Mul(x, y Number) (Number, error) {
+	return checkBig(func() (*big.Float, error) {
+		return b.newFloat().Mul(x.(*big.Float), y.(*big.Float)), nil
+	})
+}
+
+func (b bigFloatBackend) Div(x, y Number) (Number, error) {
+	if y.(*big.Float).Sign() == 0 {
+		return nil, errors.New("cannot divide by 0")
+	}
+
+	return checkBig(func() (*big.Float, error) {
+		return b.newFloat().Quo(x.(*big.Float), y.(*big.Float)), nil
+	})
+}
+
+// Pow is exact for integer exponents and falls back to float64 otherwise.
+func (b bigFloatBackend) Pow(x, y Number) (Number, error) {
+	return checkBig(func() (*big.Float, error) { return b.pow(x, y) })
+}
+
+func (b bigFloatBackend) pow(x, y Number) (*big.Float, error) {
+	base, exp := x.(*big.Float), y.(*big.Float)
+	item1, _ := base.Float64()
+	item2, _ := exp.Float64()
+	if base.Sign() == 0 && exp.Sign() == 0 {
+		return nil, checkPow(0, 0)
+	}
+	if !exp.IsInt() {
+		if err := checkPow(item1, item2); err != nil {
+			return nil, err
+		}
+		pow := math.Pow(item1, item2)
+		if math.IsInf(pow, 0) {
+			return nil, errors.New("result is out of range")
+		}
+		return b.newFloat().SetFloat64(pow), nil
+	}
+
+	n, acc := exp.Int64()
+	if acc != big.Exact || n > math.MaxInt32 || n < math.MinInt32 {
+		return nil, errors.New("exponent is too large")
+	}
+	if base.Sign() == 0 && n < 0 {
+		return nil, errors.New("cannot divide by 0")
+	}
+
+	result := b.newFloat().SetInt64(1)
+	square := b.newFloat().Set(base)
+	for k := n; k != 0; k /= 2 {
+		if k%2 != 0 {
+			result.Mul(result, square)
+		}
+		square.Mul(square, square)
+	}
+	if n < 0 {
+		result.Quo(b.newFloat().SetInt64(1), result)
+	}
+
+	return result, nil
+}
+
+func (b bigFloatBackend) Unary(name string, x Number) (Number, bool, error) {
+	val := x.(*big.Float)
+	switch name {
+	case FunctionSqrt:
+		if val.Sign() < 0 {
+			return nil, true, errors.New("cannot take the square root of a negative number")
+		}
+		return b.newFloat().Sqrt(val), true, nil
+	case FunctionAbs:
+		return b.newFloat().Abs(val), true, nil
+	case FunctionNeg:
+		return b.newFloat().Neg(val), true, nil
+	case FunctionInv:
+		if val.Sign() == 0 {
+			return nil, true, errors.New("cannot divide by 0")
+		}
+		// the inverse of a tiny number can overflow
+		inv, err := checkBig(func() (*big.Float, error) {
+			return b.newFloat().Quo(b.newFloat().SetInt64(1), val), nil
+		})
+		return inv, true, err
+	case FunctionTrunc:
+		i, _ := val.Int(nil)
+		return b.newFloat().SetInt(i), true, nil
+	case FunctionFloor, FunctionCeil, FunctionRound:
+		i, _ := val.Int(nil)
+		diff := b.newFloat().Sub(val, b.newFloat().SetInt(i))
+		half := big.NewFloat(0.5)
+		switch {
+		case name == FunctionFloor && diff.Sign() < 0:
+			i.Sub(i, big.NewInt(1))
+		case name == FunctionCeil && diff.Sign() > 0:
+			i.Add(i, big.NewInt(1))
+		case name == FunctionRound && diff.Cmp(half) >= 0:
+			i.Add(i, big.NewInt(1))
+		case name == FunctionRound && diff.Cmp(half.Neg(half)) <= 0:
+			i.Sub(i, big.NewInt(1))
+		}
+		return b.newFloat().SetInt(i), true, nil
+	}
+
+	return nil, false, nil
+}
+
+// sameNumber reports whether x and y hold the same value.
+func sameNumber(x, y Number) bool {
+	switch x := x.(type) {
+	case *big.Float:
+		y, ok := y.(*big.Float)
+		return ok && x.Cmp(y) == 0
+	case *big.Rat:
+		y, ok := y.(*big.Rat)
+		return ok && x.Cmp(y) == 0
+	}
+
+	return x == y
+}
+
+// FormatDecimals formats n with a fixed number of decimals, showing the
+// imaginary part of complex numbers when it is not zero. Integers of
+// programmer mode are shown in base, and a negative decimals formats n like
+// FormatBase.
+func FormatDecimals(b Backend, n Number, decimals, base int) string {
+	if _, ok := b.(BaseFormatter); ok || decimals < 0 {
+		return FormatBase(b, n, base)
+	}
+	switch x := n.(type) {
+	case *big.Float:
+		return x.Text('f', decimals)
+	case *big.Rat:
+		return x.FloatString(decimals)
+	case complex128:
+		if imag(x) != 0 {
+			return fmt.Sprintf("%.*f%+.*fi", decimals, real(x), decimals, imag(x))
+		}
+	}
+
+	return fmt.Sprintf("%.*f", decimals, b.Float64(n))
+}
+
+// MarshalNumber formats n, a number of the backend b, as text that
+// UnmarshalNumber turns back into the same number.
+func MarshalNumber(b Backend, n Number) string {
+	switch x := n.(type) {
+	case float64:
+		if _, ok := b.(rationalBackend); ok {
+			// always with an exponent, to tell it apart from a fraction
+			return strconv.FormatFloat(x, 'e', -1, 64)
+		}
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case *big.Float:
+		// the shortest decimal that rounds back to x at its precision
+		return x.Text('g', -1)
+	case *big.Rat:
+		return x.RatString()
+	case complex128:
+		return strconv.FormatComplex(x, 'g', -1, 128)
+	}
+
+	return b.Format(n)
+}
+
+// CheckFloat returns an error if x cannot be held by a number of the
+// backend b, as NaN and the infinities cannot by big floats. FromFloat must
+// only be given the values CheckFloat accepts.
+func CheckFloat(b Backend, x float64) error {
+	if _, ok := b.(bigFloatBackend); ok && (math.IsNaN(x) || math.IsInf(x, 0)) {
+		return fmt.Errorf("big floats cannot hold %v", x)
+	}
+
+	return nil
+}
+
+// UnmarshalNumber parses text written by MarshalNumber into a number of the
+// backend b.
+func UnmarshalNumber(b Backend, text string) (Number, error) {
+	switch b.(type) {
+	case complexBackend:
+		return strconv.ParseComplex(text, 128)
+	case rationalBackend:
+		if strings.ContainsAny(text, ".eEnNiI") {
+			return strconv.ParseFloat(text, 64)
+		}
+		return b.Parse(text)
+	}
+
+	return b.Parse(text)
+}
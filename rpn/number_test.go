@@ -0,0 +1,302 @@
+package rpn_test
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/azr4e1/polacco/rpn"
+	"github.com/google/go-cmp/cmp"
+)
+
+func newBigFloatStack(t *testing.T) *rpn.RPNStack {
+	t.Helper()
+	backend, err := rpn.NewBigFloatBackend(rpn.DefaultPrecision)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rpn.NewStackWithBackend(backend)
+}
+
+func TestBigFloatBackend_ComputesWithoutBinaryRoundingNoise(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input  string
+		Output []string
+	}
+	testCases := []TestCase{
+		{
+			Input:  "0.1 0.2 +",
+			Output: []string{"0.3"},
+		},
+		{
+			Input:  "2 64 ^",
+			Output: []string{"18446744073709551616"},
+		},
+		{
+			Input:  "9007199254740993 1 +",
+			Output: []string{"9007199254740994"},
+		},
+		{
+			Input:  "1 3 / 3 *",
+			Output: []string{"1"},
+		},
+		{
+			Input:  "2 sqrt dup *",
+			Output: []string{"2"},
+		},
+		{
+			Input:  "10 0 1 - ^",
+			Output: []string{"0.1"},
+		},
+		{
+			Input:  "1.5 floor 1.5 ceil 2.5 round 0 2.5 - round 0 1.5 - trunc",
+			Output: []string{"1", "2", "3", "-3", "-1"},
+		},
+		{
+			Input:  "1 2 3 rot swap over - abs neg",
+			Output: []string{"2", "1", "-2"},
+		},
+		{
+			Input:  "4 0.5 ^ 8 inv",
+			Output: []string{"2", "0.125"},
+		},
+	}
+	for _, tc := range testCases {
+		stack := newBigFloatStack(t)
+		err := rpn.StringParser(stack, tc.Input)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Input, err)
+		}
+
+		got := stack.Strings()
+		if !cmp.Equal(tc.Output, got) {
+			t.Errorf("%s: %s", tc.Input, cmp.Diff(tc.Output, got))
+		}
+	}
+}
+
+func TestBigFloatBackend_ReturnsErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []string{
+		"1 0 /",
+		"0 0 ^",
+		"0 2 - 0.5 ^",
+		"0 inv",
+		"0 1 - sqrt",
+		"0 ln",
+		"10 1000000000 ^",
+		"10 1000000000 ^ dup -",
+		"10 1000000000 ^ 0 *",
+		"2 2000000000 ^ 2 2000000000 ^ *",
+		"10 1000000000 neg ^ inv",
+	}
+	for _, input := range testCases {
+		stack := newBigFloatStack(t)
+		err := rpn.StringParser(stack, input)
+		if err == nil {
+			t.Errorf("want error, got nil for test case '%s'", input)
+		}
+	}
+}
+
+func TestBigFloatBackend_RejectsResultsThatOverflow(t *testing.T) {
+	t.Parallel()
+	stack := newBigFloatStack(t)
+	if err := rpn.StringParser(stack, "2 1000000000 ^"); err != nil {
+		t.Fatal(err)
+	}
+	for _, input := range []string{"dup dup * *", "dup * dup *", "inv inv dup dup * *"} {
+		err := rpn.StringParser(stack, input)
+		if err == nil {
+			t.Errorf("%s: want error, got nil", input)
+		}
+	}
+	if stack.Depth() != 1 {
+		t.Errorf("want the stack untouched, got depth %d", stack.Depth())
+	}
+}
+
+func TestNewBigFloatBackend_ReturnsErrorForInvalidPrecision(t *testing.T) {
+	t.Parallel()
+	_, err := rpn.NewBigFloatBackend(0)
+	if err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestNewStackWithBackend_ConvertsInitialValues(t *testing.T) {
+	t.Parallel()
+	backend, err := rpn.NewBigFloatBackend(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stack := rpn.NewStackWithBackend(backend, 1.5, 2)
+	if err := stack.Add(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []float64{3.5}
+	got := stack.GetValues()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestCheckFloat_RejectsValuesTheBackendCannotHold(t *testing.T) {
+	t.Parallel()
+	bigFloat, err := rpn.NewBigFloatBackend(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type TestCase struct {
+		Backend rpn.Backend
+		Value   float64
+		Valid   bool
+	}
+	testCases := []TestCase{
+		{Backend: bigFloat, Value: 1.5, Valid: true},
+		{Backend: bigFloat, Value: math.NaN(), Valid: false},
+		{Backend: bigFloat, Value: math.Inf(-1), Valid: false},
+		{Backend: rpn.FloatBackend, Value: math.NaN(), Valid: true},
+		{Backend: rpn.RationalBackend, Value: math.Inf(1), Valid: true},
+	}
+	for _, tc := range testCases {
+		err := rpn.CheckFloat(tc.Backend, tc.Value)
+		if tc.Valid != (err == nil) {
+			t.Errorf("%s %v: want valid %t, got %v", tc.Backend.Name(), tc.Value, tc.Valid, err)
+		}
+	}
+}
+
+func TestParseBackend_ReturnsTheBackendOfEachName(t *testing.T) {
+	t.Parallel()
+	names := []string{"float", "bigfloat", "rational", "complex", "int8", "int64", "uint16", "uint32"}
+	for _, name := range names {
+		backend, err := rpn.ParseBackend(name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if backend.Name() != name {
+			t.Errorf("want %s, got %s", name, backend.Name())
+		}
+	}
+
+	backend, err := rpn.ParseBackend("Rational")
+	if err != nil || backend != rpn.RationalBackend {
+		t.Errorf("want the rational backend, got %v, %v", backend, err)
+	}
+}
+
+func TestParseBackend_ReturnsErrorForUnknownNames(t *testing.T) {
+	t.Parallel()
+	for _, name := range []string{"", "decimal", "int", "int12", "uint", "8", "bigfloat64"} {
+		_, err := rpn.ParseBackend(name)
+		if err == nil {
+			t.Errorf("%q: want error, got nil", name)
+		}
+	}
+}
+
+func TestFormatDecimals_FormatsWithAFixedNumberOfDecimals(t *testing.T) {
+	t.Parallel()
+	programmer, err := rpn.NewIntegerBackend(8, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bigFloat, err := rpn.NewBigFloatBackend(rpn.DefaultPrecision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type TestCase struct {
+		Backend  rpn.Backend
+		Input    string
+		Decimals int
+		Output   string
+	}
+	testCases := []TestCase{
+		{Backend: rpn.FloatBackend, Input: "2 3 /", Decimals: 3, Output: "0.667"},
+		{Backend: rpn.FloatBackend, Input: "2 3 /", Decimals: -1, Output: "0.6666666666666666"},
+		{Backend: rpn.FloatBackend, Input: "2", Decimals: 0, Output: "2"},
+		{Backend: bigFloat, Input: "1 3 /", Decimals: 30, Output: "0.333333333333333333333333333333"},
+		{Backend: rpn.RationalBackend, Input: "1 3 /", Decimals: 4, Output: "0.3333"},
+		{Backend: rpn.RationalBackend, Input: "1 3 /", Decimals: -1, Output: "1/3"},
+		{Backend: rpn.ComplexBackend, Input: "1-2i", Decimals: 1, Output: "1.0-2.0i"},
+		{Backend: rpn.ComplexBackend, Input: "1.25", Decimals: 1, Output: "1.2"},
+		{Backend: programmer, Input: "255", Decimals: 2, Output: "0xFF"},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStackWithBackend(tc.Backend)
+		if err := rpn.StringParser(stack, tc.Input); err != nil {
+			t.Fatal(err)
+		}
+
+		got := rpn.FormatDecimals(tc.Backend, stack.GetNumbers()[0], tc.Decimals, 16)
+		if tc.Output != got {
+			t.Errorf("%s %q: want %s, got %s", tc.Backend.Name(), tc.Input, tc.Output, got)
+		}
+	}
+}
+
+func TestMarshalNumber_RoundTripsExactly(t *testing.T) {
+	t.Parallel()
+	bigFloat, err := rpn.NewBigFloatBackend(rpn.DefaultPrecision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := rpn.NewIntegerBackend(16, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type TestCase struct {
+		Backend rpn.Backend
+		Input   string
+	}
+	testCases := []TestCase{
+		{Backend: rpn.FloatBackend, Input: "0.1 0.2 + 1 3 / 1e300 -2.5 inf nan"},
+		{Backend: bigFloat, Input: "1 3 / 2 sqrt 0.1 1e-400"},
+		{Backend: rpn.RationalBackend, Input: "1 3 / -7 2 sqrt 4 sqrt 1 0.1 +"},
+		{Backend: rpn.ComplexBackend, Input: "3+4i 0 1 - sqrt 1 3 / -2.5"},
+		{Backend: signed, Input: "-5 32767 0xffff"},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStackWithBackend(tc.Backend)
+		if err := rpn.StringParser(stack, tc.Input); err != nil {
+			t.Fatalf("%q: %v", tc.Input, err)
+		}
+
+		restored := rpn.NewStackWithBackend(tc.Backend)
+		for _, val := range stack.GetNumbers() {
+			text := rpn.MarshalNumber(tc.Backend, val)
+			got, err := rpn.UnmarshalNumber(tc.Backend, text)
+			if err != nil {
+				t.Fatalf("%s %q: %v", tc.Backend.Name(), text, err)
+			}
+			restored.PushNumber(got)
+		}
+		want, got := stack.Strings(), restored.Strings()
+		if !cmp.Equal(want, got) {
+			t.Errorf("%s: %s", tc.Backend.Name(), cmp.Diff(want, got))
+		}
+	}
+}
+
+func TestMarshalNumber_KeepsTheTypeOfRationalBackendNumbers(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStackWithBackend(rpn.RationalBackend)
+	if err := rpn.StringParser(stack, "4 sqrt 1 2 /"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, val := range stack.GetNumbers() {
+		text := rpn.MarshalNumber(rpn.RationalBackend, val)
+		got, err := rpn.UnmarshalNumber(rpn.RationalBackend, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprintf("%T", got) != fmt.Sprintf("%T", val) {
+			t.Errorf("%s: want %T, got %T", text, val, got)
+		}
+	}
+}
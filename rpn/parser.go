@@ -1,10 +1,10 @@
 package rpn
 
 import (
-	"errors"
-	"fmt"
 	"strconv"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 const (
@@ -15,20 +15,26 @@ const (
 	OperationPow  = "^"
 )
 
+// IgnoreCharacters separate tokens, as does any other whitespace.
 const IgnoreCharacters = "\n \t,"
 
 type RPNElement interface {
 	Apply(*RPNStack) error
 }
 
-type RPNInt int
+// RPNInt is an integer literal written in base 16, 8 or 2, such as 0xff.
+// Literals are read as 64-bit patterns, so 0xffffffffffffffff is -1.
+type RPNInt int64
 type RPNFloat float64
 type RPNOperation string
 
-func (i RPNInt) Apply(s *RPNStack) error {
-	s.Push(float64(i))
+// RPNLiteral is a numeric literal as written in the expression. The backend
+// of the stack decides how to represent it.
+type RPNLiteral string
 
-	return nil
+func (i RPNInt) Apply(s *RPNStack) error {
+	// every backend parses decimal integers exactly
+	return RPNLiteral(strconv.FormatInt(int64(i), 10)).Apply(s)
 }
 
 func (f RPNFloat) Apply(s *RPNStack) error {
@@ -37,29 +43,24 @@ func (f RPNFloat) Apply(s *RPNStack) error {
 	return nil
 }
 
-func (o RPNOperation) Apply(s *RPNStack) error {
-	var err error
-	switch o {
-	case OperationSum:
-		err = s.Add()
-	case OperationDiff:
-		err = s.Diff()
-	case OperationDiv:
-		err = s.Div()
-	case OperationMul:
-		err = s.Mul()
-	case OperationPow:
-		err = s.Pow()
-	default:
-		err = errors.New("unknown operation")
+func (l RPNLiteral) Apply(s *RPNStack) error {
+	val, err := s.backend.Parse(string(l))
+	if err != nil {
+		return &SyntaxError{Token: string(l), Msg: "invalid number", Err: err}
 	}
+	s.PushNumber(val)
 
-	return err
+	return nil
+}
+
+func (o RPNOperation) Apply(s *RPNStack) error {
+	return applyOperator(string(o), s)
 }
 
 type RPNScanner struct {
 	token RPNElement
 	input string
+	start int
 	pos   int
 	err   error
 }
@@ -72,60 +73,77 @@ func isFloatChar(exp rune) bool {
 	return unicode.IsDigit(exp) || exp == '.'
 }
 
+func isSeparator(exp rune) bool {
+	return unicode.IsSpace(exp) || strings.ContainsRune(IgnoreCharacters, exp)
+}
+
+func isWordChar(exp rune) bool {
+	return unicode.IsLetter(exp) || unicode.IsDigit(exp) || exp == '_' || exp == '.'
+}
+
 func (s *RPNScanner) Scan() bool {
 	for s.pos < len(s.input) {
+		s.start = s.pos
 		ch := s.input[s.pos]
 		switch {
-		case unicode.IsDigit(rune(ch)):
+		case s.isBasedLiteral(s.pos):
 			start := s.pos
-			periodCounter := 0
-			for s.pos < len(s.input) && isFloatChar(rune(s.input[s.pos])) {
-				if s.input[s.pos] == '.' {
-					periodCounter++
-				}
-				if periodCounter >= 2 {
-					break
-				}
+			for s.pos < len(s.input) && isWordChar(rune(s.input[s.pos])) {
 				s.pos++
 			}
-			token := s.input[start:s.pos]
-			conv, err := strconv.ParseFloat(token, 64)
-			s.token = RPNFloat(conv)
-			s.err = err
+			val, err := strconv.ParseUint(s.input[start:s.pos], 0, 64)
+			s.token = RPNInt(val)
+			if err != nil {
+				s.token = nil
+				s.err = s.syntaxError("invalid integer literal")
+			}
 			return true
 
-		case string(ch) == OperationSum:
-			s.pos++
-			s.token = RPNOperation(ch)
+		case s.isNumberStart(s.pos):
+			s.scanNumber()
 			return true
 
-		case string(ch) == OperationDiff:
-			s.pos++
-			s.token = RPNOperation(ch)
+		case ch == '(' && s.scanComplexPair():
 			return true
 
-		case string(ch) == OperationMul:
-			s.pos++
-			s.token = RPNOperation(ch)
+		case ch == ':':
+			s.scanDefinition()
 			return true
 
-		case string(ch) == OperationDiv:
-			s.pos++
-			s.token = RPNOperation(ch)
+		case unicode.IsLetter(rune(ch)) && s.controlWord(s.pos) != "":
+			s.scanControl(s.controlWord(s.pos))
 			return true
 
-		case string(ch) == OperationPow:
+		case s.matchOperator():
+			return true
+
+		case unicode.IsLetter(rune(ch)):
+			s.scanName(false)
+			return true
+
+		case ch == '\'' && s.pos+1 < len(s.input) && unicode.IsLetter(rune(s.input[s.pos+1])):
 			s.pos++
-			s.token = RPNOperation(ch)
+			s.scanName(true)
 			return true
 
-		case unicode.IsSpace(rune(ch)):
+		case isSeparator(rune(ch)):
 			s.pos++
 
+		case ch == '#' || ch == '\\' || ch == '(':
+			end, ok := s.commentEnd(s.pos)
+			if !ok {
+				s.pos = len(s.input)
+				s.token = nil
+				s.err = &SyntaxError{Token: "(", Offset: s.start, Msg: "unterminated comment"}
+				return true
+			}
+			s.pos = end
+
 		default:
-			s.pos++
+			_, size := utf8.DecodeRuneInString(s.input[s.pos:])
+			s.pos += size
 			s.token = nil
-			s.err = fmt.Errorf("unexpected character: %s", string(ch))
+			s.err = s.syntaxError("unexpected character")
 			return true
 		}
 	}
@@ -133,21 +151,339 @@ func (s *RPNScanner) Scan() bool {
 	return false
 }
 
+// isBasedLiteral reports whether a literal prefixed by 0x, 0o or 0b starts
+// at pos.
+func (s *RPNScanner) isBasedLiteral(pos int) bool {
+	return pos+1 < len(s.input) && s.input[pos] == '0' && strings.ContainsRune("xXoObB", rune(s.input[pos+1]))
+}
+
+// isSign reports whether the character at pos makes the number that
+// follows it negative. An underscore always does. A minus sign does only when
+// it starts the expression or follows whitespace, so "3 -2" pushes 3 and -2
+// while "3 2-" and "3 2 - 2" subtract. Before literals could be signed,
+// "3 -2" subtracted 2 from 3.
+func (s *RPNScanner) isSign(pos int) bool {
+	switch s.input[pos] {
+	case '_':
+		return true
+	case '-':
+		return pos == 0 || isSeparator(rune(s.input[pos-1]))
+	}
+
+	return false
+}
+
+func (s *RPNScanner) isDigit(pos int) bool {
+	return pos < len(s.input) && unicode.IsDigit(rune(s.input[pos]))
+}
+
+// isNumberStart reports whether a decimal literal, such as 42, .5, 1e-9,
+// _3 or -inf, starts at pos. A sign must be directly followed by the number.
+func (s *RPNScanner) isNumberStart(pos int) bool {
+	if s.isSign(pos) {
+		pos++
+	}
+
+	return s.isDigit(pos) ||
+		(pos < len(s.input) && s.input[pos] == '.' && s.isDigit(pos+1)) ||
+		s.specialEnd(pos) > pos
+}
+
+// specialEnd returns the end of the inf or nan literal starting at pos, or
+// pos if there is none.
+func (s *RPNScanner) specialEnd(pos int) int {
+	end := pos + 3
+	if end > len(s.input) || (end < len(s.input) && isWordChar(rune(s.input[end]))) {
+		return pos
+	}
+	switch strings.ToLower(s.input[pos:end]) {
+	case "inf", "nan":
+		return end
+	}
+
+	return pos
+}
+
+// scanNumber scans the literal that isNumberStart found at the current
+// position.
+func (s *RPNScanner) scanNumber() {
+	sign := ""
+	if s.isSign(s.pos) {
+		sign = "-"
+		s.pos++
+	}
+
+	if end := s.specialEnd(s.pos); end > s.pos {
+		s.token = RPNLiteral(sign + strings.ToLower(s.input[s.pos:end]))
+		s.pos = end
+		return
+	}
+
+	start := s.pos
+	s.pos = s.numberEnd(s.pos)
+	literal := sign + s.input[start:s.pos]
+	if s.scanComplex(literal) {
+		return
+	}
+	if s.pos < len(s.input) && isFloatChar(rune(s.input[s.pos])) {
+		for s.pos < len(s.input) && isFloatChar(rune(s.input[s.pos])) {
+			s.pos++
+		}
+		s.token = nil
+		s.err = s.syntaxError("invalid number")
+		return
+	}
+	s.token = RPNLiteral(literal)
+}
+
+// numberEnd returns the end of the unsigned decimal number starting at pos,
+// including an exponent such as e-9.
+func (s *RPNScanner) numberEnd(pos int) int {
+	periodCounter := 0
+	for pos < len(s.input) && isFloatChar(rune(s.input[pos])) {
+		if s.input[pos] == '.' {
+			periodCounter++
+		}
+		if periodCounter >= 2 {
+			break
+		}
+		pos++
+	}
+
+	if pos < len(s.input) && (s.input[pos] == 'e' || s.input[pos] == 'E') {
+		exp := pos + 1
+		if exp < len(s.input) && strings.ContainsRune("+-", rune(s.input[exp])) {
+			exp++
+		}
+		if s.isDigit(exp) {
+			pos = exp
+			for s.isDigit(pos) {
+				pos++
+			}
+		}
+	}
+
+	return pos
+}
+
+// isImaginaryUnit reports whether an i that is not part of a word is at pos.
+func (s *RPNScanner) isImaginaryUnit(pos int) bool {
+	return pos < len(s.input) && s.input[pos] == 'i' &&
+		(pos+1 == len(s.input) || !isWordChar(rune(s.input[pos+1])))
+}
+
+// scanComplex continues literal, the number that ends at the current
+// position, if it is a complex literal such as 2i or 3+4i.
+func (s *RPNScanner) scanComplex(literal string) bool {
+	if s.isImaginaryUnit(s.pos) {
+		im, err := strconv.ParseFloat(literal, 64)
+		s.pos++
+		s.token = RPNComplex(complex(0, im))
+		if err != nil {
+			s.token = nil
+			s.err = s.syntaxError("invalid complex number")
+		}
+		return true
+	}
+
+	if s.pos+1 >= len(s.input) || !strings.ContainsRune("+-", rune(s.input[s.pos])) || !unicode.IsDigit(rune(s.input[s.pos+1])) {
+		return false
+	}
+	end := s.numberEnd(s.pos + 1)
+	if !s.isImaginaryUnit(end) {
+		return false
+	}
+
+	re, err := strconv.ParseFloat(literal, 64)
+	if err == nil {
+		var im float64
+		im, err = strconv.ParseFloat(s.input[s.pos:end], 64)
+		s.token = RPNComplex(complex(re, im))
+	}
+	s.pos = end + 1
+	if err != nil {
+		s.token = nil
+		s.err = s.syntaxError("invalid complex number")
+	}
+
+	return true
+}
+
+// scanComplexPair scans a complex literal written as (re,im).
+func (s *RPNScanner) scanComplexPair() bool {
+	z, end, ok := s.complexPair(s.pos)
+	if !ok {
+		return false
+	}
+
+	s.pos = end
+	s.token = RPNComplex(z)
+
+	return true
+}
+
+// complexPair parses the complex literal written as (re,im) at pos and
+// returns it with its end.
+func (s *RPNScanner) complexPair(pos int) (complex128, int, bool) {
+	end := strings.IndexByte(s.input[pos:], ')')
+	if end < 0 {
+		return 0, pos, false
+	}
+	parts := strings.Split(s.input[pos+1:pos+end], ",")
+	if len(parts) != 2 {
+		return 0, pos, false
+	}
+	re, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return 0, pos, false
+	}
+	im, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return 0, pos, false
+	}
+
+	return complex(re, im), pos + end + 1, true
+}
+
+// commentEnd returns the end of the comment that starts at pos, or pos if
+// there is none. Line comments start with # or \ and run to the end of the
+// line. Block comments are enclosed in parentheses and do not nest; a
+// parenthesis that encloses a complex literal such as (3,4) does not start
+// a comment. It reports false if a block comment is not closed.
+func (s *RPNScanner) commentEnd(pos int) (int, bool) {
+	if pos >= len(s.input) {
+		return pos, true
+	}
+	switch s.input[pos] {
+	case '#', '\\':
+		end := strings.IndexByte(s.input[pos:], '\n')
+		if end < 0 {
+			return len(s.input), true
+		}
+		return pos + end + 1, true
+	case '(':
+		if _, _, ok := s.complexPair(pos); ok {
+			return pos, true
+		}
+		end := strings.IndexByte(s.input[pos:], ')')
+		if end < 0 {
+			return pos, false
+		}
+		return pos + end + 1, true
+	}
+
+	return pos, true
+}
+
+// uncomment replaces the comments in src with spaces.
+func uncomment(src string) string {
+	s := NewRPNScanner(src)
+	var b strings.Builder
+	for s.pos < len(s.input) {
+		end, ok := s.commentEnd(s.pos)
+		if !ok {
+			break
+		}
+		if end > s.pos {
+			b.WriteByte(' ')
+			s.pos = end
+			continue
+		}
+		b.WriteByte(s.input[s.pos])
+		s.pos++
+	}
+
+	return b.String()
+}
+
+// scanName scans a variable name. If it is followed by sto, rcl, sto+ or
+// sto-, the name and the word form a single token; otherwise a bare name
+// recalls the variable and a quoted name is an error.
+func (s *RPNScanner) scanName(quoted bool) {
+	start := s.pos
+	for s.pos < len(s.input) && isWordChar(rune(s.input[s.pos])) {
+		s.pos++
+	}
+	name := strings.ToLower(s.input[start:s.pos])
+
+	next := s.pos
+	for next < len(s.input) && isSeparator(rune(s.input[next])) {
+		next++
+	}
+	word, ok := longestMatch(s.input[next:])
+	if _, isMemoryWord := memoryWords[word]; ok && isMemoryWord {
+		s.pos = next + len(word)
+		s.token = RPNNamedWord{Word: word, Name: name}
+		if !isVariableName(name) {
+			s.token = nil
+			s.err = s.syntaxError("invalid variable name")
+		}
+		return
+	}
+
+	s.token = RPNVariable(name)
+	if quoted {
+		s.token = nil
+		s.err = s.syntaxError("expected sto, rcl, sto+ or sto- after quoted name")
+	}
+}
+
+// matchOperator emits the longest registered operator found at the current
+// position, if any.
+func (s *RPNScanner) matchOperator() bool {
+	name, ok := longestMatch(s.input[s.pos:])
+	if !ok {
+		return false
+	}
+
+	s.pos += len(name)
+	if isWordName(name) {
+		s.token = RPNWord(name)
+	} else {
+		s.token = RPNOperation(name)
+	}
+
+	return true
+}
+
+// syntaxError reports the text of the token being scanned as invalid.
+func (s *RPNScanner) syntaxError(msg string) error {
+	return &SyntaxError{Token: s.input[s.start:s.pos], Offset: s.start, Msg: msg}
+}
+
+// Text returns the text of the last token and its byte offset in the
+// expression.
+func (s *RPNScanner) Text() (string, int) {
+	return s.input[s.start:s.pos], s.start
+}
+
 func (s *RPNScanner) Token() (RPNElement, error) {
 	token, err := s.token, s.err
 	s.token, s.err = nil, nil
 	return token, err
 }
 
+// StringParser evaluates exp on rs. The expression is atomic: if any token
+// fails to scan or apply, rs is restored to the state it had before the
+// call.
 func StringParser(rs *RPNStack, exp string) error {
+	saved := rs.snapshot()
+	rs.steps = 0
 	scanner := NewRPNScanner(exp)
 	for scanner.Scan() {
 		token, err := scanner.Token()
-		if err != nil {
-			return err
+		if err == nil {
+			err = rs.step()
+			if err == nil {
+				err = token.Apply(rs)
+			}
+			if err != nil {
+				text, offset := scanner.Text()
+				err = locate(err, text, offset)
+			}
 		}
-		err = token.Apply(rs)
 		if err != nil {
+			rs.restore(saved)
 			return err
 		}
 	}
@@ -1,6 +1,9 @@
 package rpn_test
 
 import (
+	"errors"
+	"math"
+
 	"github.com/azr4e1/polacco/rpn"
 	"github.com/google/go-cmp/cmp"
 	"testing"
@@ -86,6 +89,38 @@ func TestStringParser_ParsesANumberCorrectly(t *testing.T) {
 			Input:  "3.140000000",
 			Output: 3.14,
 		},
+		{
+			Input:  "1e-9",
+			Output: 1e-9,
+		},
+		{
+			Input:  "6.022E23",
+			Output: 6.022e23,
+		},
+		{
+			Input:  "1e+2",
+			Output: 100,
+		},
+		{
+			Input:  ".5",
+			Output: 0.5,
+		},
+		{
+			Input:  "_3",
+			Output: -3,
+		},
+		{
+			Input:  "-3",
+			Output: -3,
+		},
+		{
+			Input:  "  -.25",
+			Output: -0.25,
+		},
+		{
+			Input:  "_2.5e-3",
+			Output: -0.0025,
+		},
 	}
 	for _, tc := range testCasesInt {
 		stack := rpn.NewStack()
@@ -282,7 +317,13 @@ func TestStringParserDiff_SubtractsTwoElements(t *testing.T) {
 			Output: []float64{-999999999999999.9999999999},
 		},
 		{
+			// a minus after whitespace signs the number: this used to
+			// subtract and give [-19 15]
 			Input:  "23 42		-15   ",
+			Output: []float64{23, 42, -15},
+		},
+		{
+			Input:  "23 42-15   ",
 			Output: []float64{-19, 15},
 		},
 	}
@@ -580,3 +621,401 @@ func TestStringParserPow_ReturnsError(t *testing.T) {
 		t.Error("want error for negative ^ decimal, got nil")
 	}
 }
+
+func TestStringParserStackWords_ManipulateTheStack(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input  string
+		Output []float64
+	}
+	testCases := []TestCase{
+		{
+			Input:  "1 2 dup",
+			Output: []float64{1, 2, 2},
+		},
+		{
+			Input:  "1 2 swap -",
+			Output: []float64{1},
+		},
+		{
+			Input:  "1 2 3 drop",
+			Output: []float64{1, 2},
+		},
+		{
+			Input:  "1 2 over",
+			Output: []float64{1, 2, 1},
+		},
+		{
+			Input:  "1 2 3 rot",
+			Output: []float64{2, 3, 1},
+		},
+		{
+			Input:  "1 2 3 -rot",
+			Output: []float64{3, 1, 2},
+		},
+		{
+			Input:  "1 2 3 4 4 roll",
+			Output: []float64{2, 3, 4, 1},
+		},
+		{
+			Input:  "1 2 3 3 pick",
+			Output: []float64{1, 2, 3, 1},
+		},
+		{
+			Input:  "1 2 3 depth",
+			Output: []float64{1, 2, 3, 3},
+		},
+		{
+			Input:  "1 2 3 clear",
+			Output: []float64{},
+		},
+		{
+			Input:  "1 2 3 2 dropn",
+			Output: []float64{1},
+		},
+		{
+			Input:  "3 DUP *",
+			Output: []float64{9},
+		},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, tc.Input)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Input, err)
+		}
+		want := tc.Output
+		got := stack.GetValues()
+
+		if !approxEqStack(want, got) {
+			t.Errorf("%s: %s", tc.Input, cmp.Diff(want, got))
+		}
+	}
+}
+
+func TestStringParserStackWords_ReturnsError(t *testing.T) {
+	t.Parallel()
+	testCases := []string{
+		"dup",
+		"1 swap",
+		"1 over",
+		"1 2 rot",
+		"1 2 -rot",
+		"1 2 3 roll",
+		"1 0 roll",
+		"1 2 1.5 pick",
+		"1 3 dropn",
+		"1 2 frob",
+	}
+	for _, input := range testCases {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, input)
+		if err == nil {
+			t.Errorf("want error, got nil for test case '%s'", input)
+		}
+	}
+}
+
+func TestRPNScannerScan_EmitsWordTokens(t *testing.T) {
+	t.Parallel()
+	scanner := rpn.NewRPNScanner("2 sqrt log10 -rot")
+	want := []rpn.RPNElement{
+		rpn.RPNLiteral("2"),
+		rpn.RPNWord("sqrt"),
+		rpn.RPNWord("log10"),
+		rpn.RPNWord("-rot"),
+	}
+	got := []rpn.RPNElement{}
+	for scanner.Scan() {
+		token, err := scanner.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, token)
+	}
+
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestRPNScannerScan_ReportsUnknownWordsWithTheirOffset(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input string
+		Error string
+	}
+	testCases := []TestCase{
+		{
+			Input: "1 2 frob",
+			Error: `unknown word "frob" at offset 4`,
+		},
+		{
+			Input: "pi",
+			Error: `unknown word "pi" at offset 0`,
+		},
+		{
+			Input: "3 my_word.v2 +",
+			Error: `unknown word "my_word.v2" at offset 2`,
+		},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, tc.Input)
+		if err == nil {
+			t.Errorf("want error, got nil for test case '%s'", tc.Input)
+			continue
+		}
+		if err.Error() != tc.Error {
+			t.Errorf("want %s, got %s", tc.Error, err)
+		}
+	}
+}
+
+func TestStringParser_LeavesTheStackUntouchedOnError(t *testing.T) {
+	t.Parallel()
+	testCases := []string{
+		"1 2 + 0 /",
+		"5 0 /",
+		"/ /",
+		"1 2 3 + + + + +",
+		"4 sqrt 0 1 - sqrt",
+		"dup dup 3.1.4",
+		"1 2 frob",
+		"0 0 ^",
+	}
+	for _, input := range testCases {
+		want := []float64{7, 3}
+		stack := rpn.NewStack(want...)
+		err := rpn.StringParser(stack, input)
+		if err == nil {
+			t.Errorf("want error, got nil for test case '%s'", input)
+		}
+
+		got := stack.GetValues()
+		if !cmp.Equal(want, got) {
+			t.Errorf("%s: %s", input, cmp.Diff(want, got))
+		}
+	}
+}
+
+func TestRPNOperationApply_RestoresOperandsWhenAnOperatorFails(t *testing.T) {
+	t.Parallel()
+	err := rpn.Register(rpn.Operator{
+		Name:  "popandfail",
+		Arity: 2,
+		Func: func(s *rpn.RPNStack) error {
+			_, _ = s.Pop()
+			_, _ = s.Pop()
+			return errors.New("failed after popping")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rpn.Unregister("popandfail") })
+
+	want := []float64{1, 2, 3}
+	stack := rpn.NewStack(want...)
+	err = rpn.RPNWord("popandfail").Apply(stack)
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+
+	got := stack.GetValues()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestStringParser_ParsesSpecialValues(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input  string
+		IsNaN  bool
+		Output float64
+	}
+	testCases := []TestCase{
+		{Input: "inf", Output: math.Inf(1)},
+		{Input: "INF", Output: math.Inf(1)},
+		{Input: "-inf", Output: math.Inf(-1)},
+		{Input: "_inf", Output: math.Inf(-1)},
+		{Input: "nan", IsNaN: true},
+		{Input: "NaN", IsNaN: true},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, tc.Input)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Input, err)
+		}
+
+		got := stack.GetValues()
+		if len(got) != 1 {
+			t.Fatalf("%s: want one value, got %v", tc.Input, got)
+		}
+		if tc.IsNaN && !math.IsNaN(got[0]) || !tc.IsNaN && got[0] != tc.Output {
+			t.Errorf("%s: want %v, got %v", tc.Input, tc.Output, got[0])
+		}
+	}
+}
+
+func TestStringParser_TellsNegativeLiteralsFromMinus(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input  string
+		Output []float64
+	}
+	testCases := []TestCase{
+		{Input: "3 -2", Output: []float64{3, -2}},
+		{Input: "-3 -2 -", Output: []float64{-1}},
+		{Input: "3 2 -", Output: []float64{1}},
+		{Input: "3 2-", Output: []float64{1}},
+		{Input: "3 2-1", Output: []float64{1, 1}},
+		{Input: "3 2 - 1", Output: []float64{1, 1}},
+		{Input: "3_2", Output: []float64{3, -2}},
+		{Input: "3 _2 -", Output: []float64{5}},
+		{Input: "2e3 1E-3 *", Output: []float64{2}},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, tc.Input)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Input, err)
+		}
+
+		got := stack.GetValues()
+		if !approxEqStack(tc.Output, got) {
+			t.Errorf("%s: %s", tc.Input, cmp.Diff(tc.Output, got))
+		}
+	}
+}
+
+func TestStringParser_ReturnsErrorForMalformedLiterals(t *testing.T) {
+	t.Parallel()
+	testCases := []string{
+		"_",
+		"_x",
+		"1e",
+		"1e+",
+		"1.2.3",
+		"infinity",
+		"nanx",
+		"- 3 _",
+	}
+	for _, input := range testCases {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, input)
+		if err == nil {
+			t.Errorf("want error, got nil for test case '%s'", input)
+		}
+	}
+}
+
+func TestStringParser_ReadsSignedAndScientificLiteralsInEveryMode(t *testing.T) {
+	t.Parallel()
+	integers, err := rpn.NewIntegerBackend(8, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bigFloats, err := rpn.NewBigFloatBackend(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type TestCase struct {
+		Backend rpn.Backend
+		Input   string
+		Output  []string
+	}
+	testCases := []TestCase{
+		{Backend: rpn.RationalBackend, Input: "_1.5e-1 -2", Output: []string{"-3/20", "-2"}},
+		{Backend: bigFloats, Input: ".5 -1e3", Output: []string{"0.5", "-1000"}},
+		{Backend: rpn.ComplexBackend, Input: "-3 _2i 1e1+2i", Output: []string{"-3", "-2i", "10+2i"}},
+		{Backend: integers, Input: "_3 -128", Output: []string{"-3", "-128"}},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStackWithBackend(tc.Backend)
+		err := rpn.StringParser(stack, tc.Input)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Input, err)
+		}
+
+		got := stack.Strings()
+		if !cmp.Equal(tc.Output, got) {
+			t.Errorf("%s: %s", tc.Input, cmp.Diff(tc.Output, got))
+		}
+	}
+}
+
+func TestStringParser_IgnoresComments(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input  string
+		Output []float64
+	}
+	testCases := []TestCase{
+		{Input: "1 2 + # add them", Output: []float64{3}},
+		{Input: "1 2 \\ add them\n3", Output: []float64{1, 2, 3}},
+		{Input: "# just a comment", Output: []float64{}},
+		{Input: "1 ( the first ) 2 ( and the second ) +", Output: []float64{3}},
+		{Input: "1(inline)2 +", Output: []float64{3}},
+		{Input: "( spans\nlines ) 4", Output: []float64{4}},
+		{Input: "1 # + \n 2 ( - ) *", Output: []float64{2}},
+		{Input: "1,2,+", Output: []float64{3}},
+		{Input: ": sq ( x -- x*x ) dup * # square\n; 3 sq", Output: []float64{9}},
+		{Input: "1 if # true\n 2 ( yes ) else 3 then", Output: []float64{2}},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStack()
+		err := rpn.StringParser(stack, tc.Input)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.Input, err)
+		}
+
+		got := stack.GetValues()
+		if !cmp.Equal(tc.Output, got) {
+			t.Errorf("%q: %s", tc.Input, cmp.Diff(tc.Output, got))
+		}
+	}
+}
+
+func TestStringParser_KeepsComplexPairsApartFromComments(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStackWithBackend(rpn.ComplexBackend)
+	err := rpn.StringParser(stack, "(3,4) ( a comment, with a comma ) (1, 2) +")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"4+6i"}
+	got := stack.Strings()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestStringParser_ReturnsErrorForUnterminatedComments(t *testing.T) {
+	t.Parallel()
+	err := rpn.StringParser(rpn.NewStack(), "1 2 ( never closed")
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+	want := `unterminated comment "(" at offset 4`
+	if err.Error() != want {
+		t.Errorf("want %s, got %s", want, err)
+	}
+}
+
+func TestRPNStackDefine_StripsCommentsFromTheSource(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack()
+	err := rpn.StringParser(stack, ": sq ( x -- x*x )\n  dup * # square it\n;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def, _ := stack.Word("sq")
+	if def.Source != "dup *" {
+		t.Errorf("want dup *, got %q", def.Source)
+	}
+}
@@ -0,0 +1,207 @@
+package rpn
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+const WordToDecimal = "->dec"
+
+// DecimalBackend is implemented by backends with exact numbers that can be
+// converted to an approximate decimal on demand.
+type DecimalBackend interface {
+	ToDecimal(Number) Number
+}
+
+type rationalBackend struct{}
+
+// RationalBackend stores numbers as exact *big.Rat fractions: 1 3 / 3 * is
+// exactly 1. Operations with an irrational result, such as sqrt or a
+// fractional power, fall back to float64, and so does any arithmetic
+// involving a float64.
+var RationalBackend Backend = rationalBackend{}
+
+func (rationalBackend) Name() string {
+	return "rational"
+}
+
+func (rationalBackend) Parse(literal string) (Number, error) {
+	x, ok := new(big.Rat).SetString(literal)
+	if !ok {
+		return nil, fmt.Errorf("invalid number: %s", literal)
+	}
+
+	return x, nil
+}
+
+// FromFloat keeps integers exact and every other value as float64.
+func (rationalBackend) FromFloat(x float64) Number {
+	if x == math.Trunc(x) && !math.IsInf(x, 0) {
+		return new(big.Rat).SetFloat64(x)
+	}
+
+	return x
+}
+
+func (rationalBackend) Float64(x Number) float64 {
+	switch x := x.(type) {
+	case *big.Rat:
+		f, _ := x.Float64()
+		return f
+	}
+
+	return x.(float64)
+}
+
+func (rationalBackend) Format(x Number) string {
+	switch x := x.(type) {
+	case *big.Rat:
+		return x.RatString()
+	}
+
+	return fmt.Sprint(x)
+}
+
+func (b rationalBackend) ToDecimal(x Number) Number {
+	return b.Float64(x)
+}
+
+// rationals returns x and y as fractions, or false if either is a float64.
+func rationals(x, y Number) (*big.Rat, *big.Rat, bool) {
+	item1, ok1 := x.(*big.Rat)
+	item2, ok2 := y.(*big.Rat)
+
+	return item1, item2, ok1 && ok2
+}
+
+func (b rationalBackend) Add(x, y Number) (Number, error) {
+	if item1, item2, ok := rationals(x, y); ok {
+		return new(big.Rat).Add(item1, item2), nil
+	}
+
+	return FloatBackend.Add(b.Float64(x), b.Float64(y))
+}
+
+func (b rationalBackend) Sub(x, y Number) (Number, error) {
+	if item1, item2, ok := rationals(x, y); ok {
+		return new(big.Rat).Sub(item1, item2), nil
+	}
+
+	return FloatBackend.Sub(b.Float64(x), b.Float64(y))
+}
+
+func (b rationalBackend) Mul(x, y Number) (Number, error) {
+	if item1, item2, ok := rationals(x, y); ok {
+		return new(big.Rat).Mul(item1, item2), nil
+	}
+
+	return FloatBackend.Mul(b.Float64(x), b.Float64(y))
+}
+
+func (b rationalBackend) Div(x, y Number) (Number, error) {
+	if item1, item2, ok := rationals(x, y); ok {
+		if item2.Sign() == 0 {
+			return nil, errors.New("cannot divide by 0")
+		}
+		return new(big.Rat).Quo(item1, item2), nil
+	}
+
+	return FloatBackend.Div(b.Float64(x), b.Float64(y))
+}
+
+// MaxRationalBits bounds the size of the fractions computed by ^ with the
+// rational backend, which would otherwise take unbounded time and memory.
+const MaxRationalBits = 1 << 20
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
+
+// Pow is exact when both operands are fractions and the exponent is an
+// integer.
+func (b rationalBackend) Pow(x, y Number) (Number, error) {
+	base, exp, ok := rationals(x, y)
+	if !ok || !exp.IsInt() {
+		return FloatBackend.Pow(b.Float64(x), b.Float64(y))
+	}
+	if base.Sign() == 0 && exp.Sign() == 0 {
+		return nil, checkPow(0, 0)
+	}
+	if !exp.Num().IsInt64() || exp.Num().Int64() > math.MaxInt32 || exp.Num().Int64() < math.MinInt32 {
+		return nil, errors.New("exponent is too large")
+	}
+
+	n := exp.Num().Int64()
+	if base.Sign() == 0 && n < 0 {
+		return nil, errors.New("cannot divide by 0")
+	}
+	// the result has about |n| times as many bits as the base
+	bits := int64(max(base.Num().BitLen(), base.Denom().BitLen()) - 1)
+	if bits > 0 && abs64(n) > MaxRationalBits/bits {
+		return nil, &DomainError{Op: OperationPow, Err: fmt.Errorf("result would exceed %d bits", MaxRationalBits)}
+	}
+	k := big.NewInt(n)
+	k.Abs(k)
+	num := new(big.Int).Exp(base.Num(), k, nil)
+	den := new(big.Int).Exp(base.Denom(), k, nil)
+	if n < 0 {
+		num, den = den, num
+	}
+
+	return new(big.Rat).SetFrac(num, den), nil
+}
+
+func (b rationalBackend) Unary(name string, x Number) (Number, bool, error) {
+	val, ok := x.(*big.Rat)
+	if !ok {
+		return nil, false, nil
+	}
+
+	switch name {
+	case FunctionAbs:
+		return new(big.Rat).Abs(val), true, nil
+	case FunctionNeg:
+		return new(big.Rat).Neg(val), true, nil
+	case FunctionInv:
+		if val.Sign() == 0 {
+			return nil, true, errors.New("cannot divide by 0")
+		}
+		return new(big.Rat).Inv(val), true, nil
+	case FunctionFloor, FunctionCeil, FunctionRound, FunctionTrunc:
+		// QuoRem truncates towards zero and leaves a remainder with the sign of val
+		q, m := new(big.Int).QuoRem(val.Num(), val.Denom(), new(big.Int))
+		twice := new(big.Int).Mul(new(big.Int).Abs(m), big.NewInt(2))
+		switch {
+		case name == FunctionFloor && m.Sign() < 0:
+			q.Sub(q, big.NewInt(1))
+		case name == FunctionCeil && m.Sign() > 0:
+			q.Add(q, big.NewInt(1))
+		case name == FunctionRound && twice.Cmp(val.Denom()) >= 0:
+			q.Add(q, big.NewInt(int64(m.Sign())))
+		}
+		return new(big.Rat).SetInt(q), true, nil
+	}
+
+	return nil, false, nil
+}
+
+func toDecimal(s *RPNStack) error {
+	b, ok := s.backend.(DecimalBackend)
+	if !ok {
+		return nil
+	}
+
+	val, err := s.PopNumber()
+	if err != nil {
+		return err
+	}
+	s.PushNumber(b.ToDecimal(val))
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package rpn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/azr4e1/polacco/rpn"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRationalBackend_KeepsArithmeticExact(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Input  string
+		Output []string
+	}
+	testCases := []TestCase{
+		{
+			Input:  "1 3 / 3 *",
+			Output: []string{"1"},
+		},
+		{
+			Input:  "7 3 /",
+			Output: []string{"7/3"},
+		},
+		{
+			Input:  "1 3 / 1 6 / +",
+			Output: []string{"1/2"},
+		},
+		{
+			Input:  "0.1 0.2 + 3 10 / -",
+			Output: []string{"0"},
+		},
+		{
+			Input:  "2 3 / 3 ^ 2 0 2 - ^",
+			Output: []string{"8/27", "1/4"},
+		},
+		{
+			Input:  "7 3 / ->dec",
+			Output: []string{"2.3333333333333335"},
+		},
+		{
+			Input:  "2 0.5 ^",
+			Output: []string{"1.4142135623730951"},
+		},
+		{
+			Input:  "2 sqrt dup * 16 sqrt",
+			Output: []string{"2.0000000000000004", "4"},
+		},
+		{
+			Input:  "7 2 / floor 7 2 / ceil 7 2 / round 0 7 2 / - round 0 7 2 / - trunc",
+			Output: []string{"3", "4", "4", "-4", "-3"},
+		},
+		{
+			Input:  "2 3 / inv neg abs",
+			Output: []string{"3/2"},
+		},
+		{
+			Input:  "1 2 3 depth",
+			Output: []string{"1", "2", "3", "3"},
+		},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStackWithBackend(rpn.RationalBackend)
+		err := rpn.StringParser(stack, tc.Input)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Input, err)
+		}
+
+		got := stack.Strings()
+		if !cmp.Equal(tc.Output, got) {
+			t.Errorf("%s: %s", tc.Input, cmp.Diff(tc.Output, got))
+		}
+	}
+}
+
+func TestRationalBackend_ReturnsErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []string{
+		"1 0 /",
+		"0 0 ^",
+		"0 0 1 - ^",
+		"0 2 - 0.5 ^",
+		"0 inv",
+		"3 20000000 ^",
+		"10 2147483647 ^",
+		"2 3 / 0 2147483647 - ^",
+	}
+	for _, input := range testCases {
+		stack := rpn.NewStackWithBackend(rpn.RationalBackend)
+		err := rpn.StringParser(stack, input)
+		if err == nil {
+			t.Errorf("want error, got nil for test case '%s'", input)
+		}
+	}
+}
+
+func TestRationalBackendPow_BoundsTheSizeOfResults(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStackWithBackend(rpn.RationalBackend)
+	err := rpn.StringParser(stack, "1 2147483647 ^ 0 1 - 2147483647 ^ 2 1000000 ^")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rpn.StringParser(stack, "10 2147483647 ^")
+	var domainErr *rpn.DomainError
+	if !errors.As(err, &domainErr) || domainErr.Op != "^" {
+		t.Errorf("want a domain error for ^, got %v", err)
+	}
+}
+
+func TestToDecimal_IsANoOpForFloats(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack()
+	err := rpn.StringParser(stack, "7 3 / ->dec")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []float64{7.0 / 3.0}
+	got := stack.GetValues()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
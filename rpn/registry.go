@@ -0,0 +1,220 @@
+package rpn
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Operator describes an operation that can be used in expressions. Name is
+// either a word such as sqrt, made of letters, digits, underscores and
+// dots, or a symbol such as + made of punctuation. Arity is the number of
+// elements the operator needs on the stack; Func is only called when the
+// stack holds at least that many. If Func fails, the stack is restored to
+// what it was before, unless the operator is Atomic: Func then promises to
+// leave the stack and the variables untouched when it fails, which saves
+// copying them on every call.
+type Operator struct {
+	Name   string
+	Arity  int
+	Func   func(*RPNStack) error
+	Help   string
+	Atomic bool
+}
+
+type registry struct {
+	mu        sync.RWMutex
+	operators map[string]Operator
+	order     []string
+}
+
+var operators = &registry{operators: map[string]Operator{}}
+
+// Register adds op to the operators recognized by the scanner. Word names
+// are case insensitive. It is an error to register a name twice.
+func Register(op Operator) error {
+	name := strings.ToLower(op.Name)
+	if err := validateName(name); err != nil {
+		return err
+	}
+	if op.Func == nil {
+		return fmt.Errorf("operator %q has no function", name)
+	}
+	if op.Arity < 0 {
+		return fmt.Errorf("operator %q has negative arity", name)
+	}
+
+	operators.mu.Lock()
+	defer operators.mu.Unlock()
+	if _, ok := operators.operators[name]; ok {
+		return fmt.Errorf("operator %q is already registered", name)
+	}
+	op.Name = name
+	operators.operators[name] = op
+	operators.order = append(operators.order, name)
+
+	return nil
+}
+
+// MustRegister is like Register but panics on error.
+func MustRegister(op Operator) {
+	if err := Register(op); err != nil {
+		panic(err)
+	}
+}
+
+// unregister removes the operator registered under name. Tests use it to
+// leave the registry as they found it.
+func unregister(name string) {
+	name = strings.ToLower(name)
+	operators.mu.Lock()
+	defer operators.mu.Unlock()
+	delete(operators.operators, name)
+	for i, other := range operators.order {
+		if other == name {
+			operators.order = append(operators.order[:i:i], operators.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Lookup returns the operator registered under name.
+func Lookup(name string) (Operator, bool) {
+	operators.mu.RLock()
+	defer operators.mu.RUnlock()
+	op, ok := operators.operators[strings.ToLower(name)]
+
+	return op, ok
+}
+
+// Operators returns every registered operator in registration order.
+func Operators() []Operator {
+	operators.mu.RLock()
+	defer operators.mu.RUnlock()
+	ops := make([]Operator, 0, len(operators.order))
+	for _, name := range operators.order {
+		ops = append(ops, operators.operators[name])
+	}
+
+	return ops
+}
+
+// IsWord reports whether name is a registered word.
+func IsWord(name string) bool {
+	_, ok := Lookup(name)
+
+	return ok && isWordName(name)
+}
+
+// longestMatch returns the longest registered name found at the start of
+// input. A word only matches if it is not directly followed by another
+// word character, so dup does not match the start of dupe.
+func longestMatch(input string) (string, bool) {
+	operators.mu.RLock()
+	defer operators.mu.RUnlock()
+	match := ""
+	for _, name := range operators.order {
+		if len(name) <= len(match) || len(name) > len(input) {
+			continue
+		}
+		if !strings.EqualFold(input[:len(name)], name) {
+			continue
+		}
+		last := rune(name[len(name)-1])
+		if isWordChar(last) && len(name) < len(input) && isWordChar(rune(input[len(name)])) {
+			continue
+		}
+		match = name
+	}
+
+	return match, match != ""
+}
+
+func isWordName(name string) bool {
+	return len(name) > 0 && (unicode.IsLetter(rune(name[0])) ||
+		len(name) > 1 && string(name[0]) == OperationDiff && unicode.IsLetter(rune(name[1])))
+}
+
+func validateName(name string) error {
+	if name == "" {
+		return errors.New("operator name is empty")
+	}
+	for _, ch := range name {
+		if unicode.IsSpace(ch) {
+			return fmt.Errorf("invalid character %q in operator name %q", ch, name)
+		}
+	}
+	if isFloatChar(rune(name[0])) {
+		return fmt.Errorf("operator name %q cannot start like a number", name)
+	}
+
+	return nil
+}
+
+func applyOperator(name string, s *RPNStack) error {
+	op, ok := Lookup(name)
+	if !ok {
+		return fmt.Errorf("unknown operation: %s", name)
+	}
+	if s.Depth() < op.Arity {
+		return &StackUnderflowError{Op: op.Name, Required: op.Arity, Available: s.Depth()}
+	}
+
+	if op.Atomic {
+		if err := op.Func(s); err != nil {
+			return opError(op.Name, err)
+		}
+		return nil
+	}
+
+	// operators registered by embedders may fail after consuming some of
+	// their operands, so every other operator gets the same rollback
+	// guarantee
+	saved := s.snapshot()
+	err := op.Func(s)
+	if err != nil {
+		s.restore(saved)
+		return opError(op.Name, err)
+	}
+
+	return nil
+}
+
+func init() {
+	builtins := []Operator{
+		{Name: OperationSum, Arity: 2, Func: (*RPNStack).Add, Help: "sum"},
+		{Name: OperationDiff, Arity: 2, Func: (*RPNStack).Diff, Help: "diff"},
+		{Name: OperationMul, Arity: 2, Func: (*RPNStack).Mul, Help: "mul"},
+		{Name: OperationDiv, Arity: 2, Func: (*RPNStack).Div, Help: "div"},
+		{Name: OperationPow, Arity: 2, Func: (*RPNStack).Pow, Help: "pow"},
+	}
+	builtins = append(builtins, stackWords...)
+	builtins = append(builtins, Operator{
+		Name:  WordToDecimal,
+		Arity: 1,
+		Func:  toDecimal,
+		Help:  "convert an exact fraction to a decimal",
+	})
+	builtins = append(builtins, controlOperators...)
+	builtins = append(builtins, memoryOperators...)
+	builtins = append(builtins, complexWords...)
+	builtins = append(builtins, integerWords...)
+	for _, f := range unaryFunctions {
+		builtins = append(builtins, Operator{
+			Name:  f.name,
+			Arity: 1,
+			Func: func(s *RPNStack) error {
+				return s.unaryFunction(f)
+			},
+			Help: f.help,
+		})
+	}
+
+	// the builtins check their operands before changing the stack
+	for _, op := range builtins {
+		op.Atomic = true
+		MustRegister(op)
+	}
+}
@@ -0,0 +1,112 @@
+package rpn_test
+
+import (
+	"testing"
+
+	"github.com/azr4e1/polacco/rpn"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRegister_AddsOperatorsToTheScanner(t *testing.T) {
+	t.Parallel()
+	err := rpn.Register(rpn.Operator{
+		Name:  "avg2",
+		Arity: 2,
+		Func: func(s *rpn.RPNStack) error {
+			if err := s.Add(); err != nil {
+				return err
+			}
+			s.Push(2)
+			return s.Div()
+		},
+		Help: "average of the top two elements",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rpn.Unregister("avg2") })
+	err = rpn.Register(rpn.Operator{
+		Name:  "%%",
+		Arity: 1,
+		Func: func(s *rpn.RPNStack) error {
+			s.Push(100)
+			return s.Div()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rpn.Unregister("%%") })
+
+	stack := rpn.NewStack()
+	err = rpn.StringParser(stack, "1 3 AVG2 50%%")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []float64{2, 0.5}
+	got := stack.GetValues()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+
+	op, ok := rpn.Lookup("avg2")
+	if !ok {
+		t.Fatal("want avg2 to be registered")
+	}
+	if op.Help != "average of the top two elements" {
+		t.Errorf("unexpected help text %q", op.Help)
+	}
+}
+
+func TestRegister_ReturnsErrorForInvalidOperators(t *testing.T) {
+	t.Parallel()
+	noop := func(*rpn.RPNStack) error { return nil }
+	testCases := []rpn.Operator{
+		{Name: "", Func: noop},
+		{Name: "two words", Func: noop},
+		{Name: "1up", Func: noop},
+		{Name: ".x", Func: noop},
+		{Name: "nofunc"},
+		{Name: "negative", Arity: -1, Func: noop},
+		{Name: rpn.OperationSum, Arity: 2, Func: noop},
+		{Name: "DUP", Arity: 1, Func: noop},
+	}
+	for _, op := range testCases {
+		if err := rpn.Register(op); err == nil {
+			t.Errorf("want error, got nil for operator %q", op.Name)
+		}
+	}
+}
+
+func TestOperators_ListsTheBuiltins(t *testing.T) {
+	t.Parallel()
+	names := map[string]bool{}
+	for _, op := range rpn.Operators() {
+		names[op.Name] = true
+	}
+	for _, name := range []string{"+", "-", "*", "/", "^", "dup", "-rot", "sqrt", "trunc"} {
+		if !names[name] {
+			t.Errorf("want %q among the registered operators", name)
+		}
+	}
+}
+
+func TestOperators_MarksTheBuiltinsAtomic(t *testing.T) {
+	t.Parallel()
+	for _, name := range []string{"+", "dup", "roll", "sqrt", "<", "i", "sto", "sto+", "r->c", "and"} {
+		op, ok := rpn.Lookup(name)
+		if !ok || !op.Atomic {
+			t.Errorf("want %q to be a registered atomic operator", name)
+		}
+	}
+}
+
+func TestStringParser_ChecksTheArityOfOperators(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack(1, 2)
+	err := rpn.StringParser(stack, "rot")
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+}
@@ -2,167 +2,290 @@ package rpn
 
 import (
 	"errors"
+	"fmt"
 	"math"
 )
 
 type RPNStack struct {
-	values []float64
+	values         []Number
+	vars           map[string]Number
+	words          map[string]compiled
+	recursionLimit int
+	reserved       func(name string) bool
+	calls          int
+	stepLimit      int
+	steps          int
+	loops          []int64
+	backend        Backend
 }
 
 func NewStack(val ...float64) *RPNStack {
-	return &RPNStack{values: val}
+	return NewStackWithBackend(FloatBackend, val...)
 }
 
+// NewStackWithBackend creates a stack whose numbers are stored and computed
+// by backend. The values must be accepted by CheckFloat.
+func NewStackWithBackend(backend Backend, val ...float64) *RPNStack {
+	vals := make([]Number, len(val))
+	for i, v := range val {
+		vals[i] = backend.FromFloat(v)
+	}
+
+	return &RPNStack{values: vals, backend: backend}
+}
+
+func (r *RPNStack) Backend() Backend {
+	return r.backend
+}
+
+// GetValues returns the stack converted to float64, which may lose
+// precision with backends other than FloatBackend.
 func (r *RPNStack) GetValues() []float64 {
 	vals := make([]float64, len(r.values))
-	copy(vals, r.values)
+	for i, v := range r.values {
+		vals[i] = r.backend.Float64(v)
+	}
+
+	return vals
+}
+
+func (r *RPNStack) GetNumbers() []Number {
+	return copyValues(r.values)
+}
+
+// Strings returns the stack formatted by its backend.
+func (r *RPNStack) Strings() []string {
+	vals := make([]string, len(r.values))
+	for i, v := range r.values {
+		vals[i] = r.backend.Format(v)
+	}
 
 	return vals
 }
 
+// state is a copy of the stack contents, variables and user-defined words.
+type state struct {
+	values []Number
+	vars   map[string]Number
+	words  map[string]compiled
+}
+
+// snapshot returns a copy of the stack contents, variables and user-defined
+// words that restore can bring back after a failed operation.
+func (r *RPNStack) snapshot() state {
+	return state{values: copyValues(r.values), vars: copyVariables(r.vars), words: r.words}
+}
+
+func (r *RPNStack) restore(saved state) {
+	r.values = saved.values
+	r.vars = saved.vars
+	r.words = saved.words
+}
+
 func (r *RPNStack) Pop() (float64, error) {
+	val, err := r.PopNumber()
+	if err != nil {
+		return 0, err
+	}
+
+	return r.backend.Float64(val), nil
+}
+
+func (r *RPNStack) PopNumber() (Number, error) {
 	length := len(r.values)
 	if length < 1 {
-		return 0, errors.New("stack is empty")
+		return nil, &StackUnderflowError{Op: "pop", Required: 1, Available: length}
 	}
 
-	var val float64
+	var val Number
 	val, r.values = r.values[length-1], r.values[:length-1]
 
 	return val, nil
 }
 
 func (r *RPNStack) Push(item float64) {
-	r.values = append(r.values, item)
+	r.PushNumber(r.backend.FromFloat(item))
 }
 
-func (r *RPNStack) Add() error {
-	if len(r.values) < 2 {
-		return errors.New("not enough elements in the stack")
-	}
-
-	var item2, item1 float64
-	var err error
+// PushNumber pushes a number that must have been produced by the backend
+// of the stack.
+func (r *RPNStack) PushNumber(item Number) {
+	r.values = append(r.values, item)
+}
 
-	item2, err = r.Pop()
-	if err != nil {
-		return err
+// binary replaces the top two elements of the stack with f applied to
+// them, the top being the second argument. The stack is left untouched if
+// f fails.
+func (r *RPNStack) binary(f func(Number, Number) (Number, error)) error {
+	length := len(r.values)
+	if length < 2 {
+		return underflow(2, length)
 	}
 
-	item1, err = r.Pop()
+	item1, item2 := r.values[length-2], r.values[length-1]
+	val, err := f(item1, item2)
 	if err != nil {
 		return err
 	}
 
-	sum := item1 + item2
-	r.Push(sum)
+	r.values = r.values[:length-1]
+	r.values[length-2] = val
 
 	return nil
 }
 
+func (r *RPNStack) Add() error {
+	return r.binary(r.backend.Add)
+}
+
 func (r *RPNStack) Diff() error {
-	if len(r.values) < 2 {
-		return errors.New("not enough elements in the stack")
-	}
+	return r.binary(r.backend.Sub)
+}
 
-	var item2, item1 float64
-	var err error
+func (r *RPNStack) Div() error {
+	return r.binary(r.backend.Div)
+}
 
-	item2, err = r.Pop()
-	if err != nil {
-		return err
-	}
+func (r *RPNStack) Mul() error {
+	return r.binary(r.backend.Mul)
+}
 
-	item1, err = r.Pop()
-	if err != nil {
-		return err
+func (r *RPNStack) Pow() error {
+	return r.binary(r.backend.Pow)
+}
+
+func (r *RPNStack) Depth() int {
+	return len(r.values)
+}
+
+func (r *RPNStack) Clear() {
+	r.values = nil
+}
+
+func (r *RPNStack) Dup() error {
+	length := len(r.values)
+	if length < 1 {
+		return underflow(1, length)
 	}
 
-	diff := item1 - item2
-	r.Push(diff)
+	r.PushNumber(r.values[length-1])
 
 	return nil
 }
 
-func (r *RPNStack) Div() error {
-	if len(r.values) < 2 {
-		return errors.New("not enough elements in the stack")
+func (r *RPNStack) Swap() error {
+	length := len(r.values)
+	if length < 2 {
+		return underflow(2, length)
 	}
 
-	var item2, item1 float64
-	var err error
+	r.values[length-1], r.values[length-2] = r.values[length-2], r.values[length-1]
 
-	item2, err = r.Pop()
-	if err != nil {
-		return err
-	}
-	if item2 == 0 {
-		return errors.New("cannot divide by 0")
-	}
+	return nil
+}
 
-	item1, err = r.Pop()
-	if err != nil {
-		return err
+func (r *RPNStack) Drop() error {
+	_, err := r.Pop()
+
+	return err
+}
+
+func (r *RPNStack) DropN(n int) error {
+	if n < 0 {
+		return errors.New("cannot drop a negative number of elements")
+	}
+	if len(r.values) < n {
+		return underflow(n, len(r.values))
 	}
 
-	div := item1 / item2
-	r.Push(div)
+	r.values = r.values[:len(r.values)-n]
 
 	return nil
 }
 
-func (r *RPNStack) Mul() error {
-	if len(r.values) < 2 {
-		return errors.New("not enough elements in the stack")
+func (r *RPNStack) Over() error {
+	return r.Pick(2)
+}
+
+// Pick copies the n-th element of the stack on top of it; level 1 is the
+// top of the stack, so 1 pick is the same as dup.
+func (r *RPNStack) Pick(n int) error {
+	if n < 1 {
+		return errors.New("stack level must be at least 1")
+	}
+	length := len(r.values)
+	if length < n {
+		return underflow(n, length)
 	}
 
-	var item2, item1 float64
-	var err error
+	r.PushNumber(r.values[length-n])
 
-	item2, err = r.Pop()
-	if err != nil {
-		return err
-	}
+	return nil
+}
 
-	item1, err = r.Pop()
-	if err != nil {
-		return err
+// Roll moves the n-th element of the stack to the top, shifting the
+// elements above it down by one level: 2 roll is swap, 3 roll is rot.
+func (r *RPNStack) Roll(n int) error {
+	if n < 1 {
+		return errors.New("stack level must be at least 1")
+	}
+	length := len(r.values)
+	if length < n {
+		return underflow(n, length)
 	}
 
-	mul := item1 * item2
-	r.Push(mul)
+	val := r.values[length-n]
+	copy(r.values[length-n:], r.values[length-n+1:])
+	r.values[length-1] = val
 
 	return nil
 }
 
-func (r *RPNStack) Pow() error {
-	if len(r.values) < 2 {
-		return errors.New("not enough elements in the stack")
+// RollDown is the inverse of Roll: it moves the top of the stack down to
+// the n-th level.
+func (r *RPNStack) RollDown(n int) error {
+	if n < 1 {
+		return errors.New("stack level must be at least 1")
+	}
+	length := len(r.values)
+	if length < n {
+		return underflow(n, length)
 	}
 
-	var item2, item1 float64
-	var err error
+	val := r.values[length-1]
+	copy(r.values[length-n+1:], r.values[length-n:length-1])
+	r.values[length-n] = val
 
-	item2, err = r.Pop()
-	if err != nil {
-		return err
-	}
+	return nil
+}
 
-	item1, err = r.Pop()
-	if err != nil {
-		return err
-	}
+func (r *RPNStack) Rot() error {
+	return r.Roll(3)
+}
 
-	if item1 == 0 && item2 == 0 {
-		return errors.New("cannot raise 0 to the power of 0")
+func (r *RPNStack) Unrot() error {
+	return r.RollDown(3)
+}
+
+// popLevel pops the top of the stack and interprets it as a stack level
+// or count for words such as roll, pick and dropn. The value is only
+// consumed if it is an integer no smaller than least and the stack holds
+// enough elements below it.
+func (r *RPNStack) popLevel(least int) (int, error) {
+	length := len(r.values)
+	if length < 1 {
+		return 0, underflow(1, length)
 	}
 
-	if item1 < 0 && item2-math.Trunc(item2) != 0 {
-		return errors.New("cannot raise a negative number to a fractional exponent")
+	val := r.backend.Float64(r.values[length-1])
+	if val < float64(least) || val != math.Trunc(val) {
+		return 0, fmt.Errorf("stack level must be an integer greater than or equal to %d", least)
+	}
+	if int(val) > length-1 {
+		return 0, underflow(int(val)+1, length)
 	}
 
-	pow := math.Pow(item1, item2)
-	r.Push(pow)
+	r.values = r.values[:length-1]
 
-	return nil
+	return int(val), nil
 }
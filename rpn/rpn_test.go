@@ -228,3 +228,148 @@ func TestRPNStackPow_ReturnsErrorIfNotEnoughElementsInTheStack(t *testing.T) {
 		t.Error("want error, got nil for stack with one item")
 	}
 }
+
+func TestRPNStackStackWords_ReorderTheStack(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Name   string
+		Word   func(*rpn.RPNStack) error
+		Output []float64
+	}
+	testCases := []TestCase{
+		{
+			Name:   "dup",
+			Word:   (*rpn.RPNStack).Dup,
+			Output: []float64{1, 2, 3, 4, 4},
+		},
+		{
+			Name:   "swap",
+			Word:   (*rpn.RPNStack).Swap,
+			Output: []float64{1, 2, 4, 3},
+		},
+		{
+			Name:   "drop",
+			Word:   (*rpn.RPNStack).Drop,
+			Output: []float64{1, 2, 3},
+		},
+		{
+			Name:   "over",
+			Word:   (*rpn.RPNStack).Over,
+			Output: []float64{1, 2, 3, 4, 3},
+		},
+		{
+			Name:   "rot",
+			Word:   (*rpn.RPNStack).Rot,
+			Output: []float64{1, 3, 4, 2},
+		},
+		{
+			Name:   "-rot",
+			Word:   (*rpn.RPNStack).Unrot,
+			Output: []float64{1, 4, 2, 3},
+		},
+		{
+			Name:   "4 roll",
+			Word:   func(s *rpn.RPNStack) error { return s.Roll(4) },
+			Output: []float64{2, 3, 4, 1},
+		},
+		{
+			Name:   "4 pick",
+			Word:   func(s *rpn.RPNStack) error { return s.Pick(4) },
+			Output: []float64{1, 2, 3, 4, 1},
+		},
+		{
+			Name:   "3 dropn",
+			Word:   func(s *rpn.RPNStack) error { return s.DropN(3) },
+			Output: []float64{1},
+		},
+		{
+			Name:   "1 roll",
+			Word:   func(s *rpn.RPNStack) error { return s.Roll(1) },
+			Output: []float64{1, 2, 3, 4},
+		},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStack(1, 2, 3, 4)
+		err := tc.Word(stack)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Name, err)
+		}
+
+		got := stack.GetValues()
+		if !cmp.Equal(tc.Output, got) {
+			t.Errorf("%s: %s", tc.Name, cmp.Diff(tc.Output, got))
+		}
+	}
+}
+
+func TestRPNStackStackWords_ReturnErrorIfNotEnoughElementsInTheStack(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Name  string
+		Word  func(*rpn.RPNStack) error
+		Input []float64
+	}
+	testCases := []TestCase{
+		{Name: "dup", Word: (*rpn.RPNStack).Dup},
+		{Name: "swap", Word: (*rpn.RPNStack).Swap, Input: []float64{1}},
+		{Name: "drop", Word: (*rpn.RPNStack).Drop},
+		{Name: "over", Word: (*rpn.RPNStack).Over, Input: []float64{1}},
+		{Name: "rot", Word: (*rpn.RPNStack).Rot, Input: []float64{1, 2}},
+		{Name: "-rot", Word: (*rpn.RPNStack).Unrot, Input: []float64{1, 2}},
+		{Name: "4 roll", Word: func(s *rpn.RPNStack) error { return s.Roll(4) }, Input: []float64{1, 2, 3}},
+		{Name: "0 pick", Word: func(s *rpn.RPNStack) error { return s.Pick(0) }, Input: []float64{1, 2, 3}},
+		{Name: "4 dropn", Word: func(s *rpn.RPNStack) error { return s.DropN(4) }, Input: []float64{1, 2, 3}},
+	}
+	for _, tc := range testCases {
+		stack := rpn.NewStack(tc.Input...)
+		err := tc.Word(stack)
+		if err == nil {
+			t.Errorf("%s: want error, got nil", tc.Name)
+		}
+
+		got := stack.GetValues()
+		if len(tc.Input) != len(got) {
+			t.Errorf("%s: stack changed on error, got %v", tc.Name, got)
+		}
+	}
+}
+
+func TestRPNStackDepthAndClear_ReportAndEmptyTheStack(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack(1, 2, 3)
+	if got := stack.Depth(); got != 3 {
+		t.Errorf("want depth 3, got %d", got)
+	}
+
+	stack.Clear()
+	if got := stack.Depth(); got != 0 {
+		t.Errorf("want depth 0 after clear, got %d", got)
+	}
+}
+
+func TestRPNStackBinaryOperations_LeaveTheStackUntouchedOnError(t *testing.T) {
+	t.Parallel()
+	stack := rpn.NewStack(3, 0)
+	err := stack.Div()
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+
+	want := []float64{3, 0}
+	got := stack.GetValues()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+
+	stack = rpn.NewStack(-2, 0.5)
+	err = stack.Pow()
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+
+	want = []float64{-2, 0.5}
+	got = stack.GetValues()
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
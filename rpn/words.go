@@ -0,0 +1,85 @@
+package rpn
+
+// Stack manipulation words.
+const (
+	WordDup   = "dup"
+	WordSwap  = "swap"
+	WordDrop  = "drop"
+	WordDropN = "dropn"
+	WordOver  = "over"
+	WordRot   = "rot"
+	WordUnrot = "-rot"
+	WordRoll  = "roll"
+	WordPick  = "pick"
+	WordDepth = "depth"
+	WordClear = "clear"
+)
+
+// RPNWord is a named token such as dup or sqrt. The scanner only emits
+// words that are registered operators.
+type RPNWord string
+
+func (w RPNWord) Apply(s *RPNStack) error {
+	return applyOperator(string(w), s)
+}
+
+var stackWords = []Operator{
+	{Name: WordDup, Arity: 1, Func: (*RPNStack).Dup, Help: "duplicate the top element"},
+	{Name: WordSwap, Arity: 2, Func: (*RPNStack).Swap, Help: "swap the top two elements"},
+	{Name: WordDrop, Arity: 1, Func: (*RPNStack).Drop, Help: "discard the top element"},
+	{Name: WordOver, Arity: 2, Func: (*RPNStack).Over, Help: "copy the second element on top"},
+	{Name: WordRot, Arity: 3, Func: (*RPNStack).Rot, Help: "move the third element on top"},
+	{Name: WordUnrot, Arity: 3, Func: (*RPNStack).Unrot, Help: "move the top element to the third level"},
+	{
+		Name:  WordRoll,
+		Arity: 1,
+		Func: func(s *RPNStack) error {
+			n, err := s.popLevel(1)
+			if err != nil {
+				return err
+			}
+			return s.Roll(n)
+		},
+		Help: "n roll: move the n-th element on top",
+	},
+	{
+		Name:  WordPick,
+		Arity: 1,
+		Func: func(s *RPNStack) error {
+			n, err := s.popLevel(1)
+			if err != nil {
+				return err
+			}
+			return s.Pick(n)
+		},
+		Help: "n pick: copy the n-th element on top",
+	},
+	{
+		Name:  WordDropN,
+		Arity: 1,
+		Func: func(s *RPNStack) error {
+			n, err := s.popLevel(0)
+			if err != nil {
+				return err
+			}
+			return s.DropN(n)
+		},
+		Help: "n dropn: discard the top n elements",
+	},
+	{
+		Name: WordDepth,
+		Func: func(s *RPNStack) error {
+			s.Push(float64(s.Depth()))
+			return nil
+		},
+		Help: "push the number of elements in the stack",
+	},
+	{
+		Name: WordClear,
+		Func: func(s *RPNStack) error {
+			s.Clear()
+			return nil
+		},
+		Help: "discard every element",
+	},
+}
@@ -0,0 +1,68 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Stdin is the script name that makes Batch read the script from the
+// input of the session.
+const Stdin = "-"
+
+// SetTopOnly makes Batch and Eval print only the top of the final stack.
+func SetTopOnly(topOnly bool) option {
+	return func(s *Session) error {
+		s.topOnly = topOnly
+		return nil
+	}
+}
+
+// Batch runs the scripts at paths one after the other, without prompts,
+// and prints the final stack, or only its top. It stops at the first
+// failing script; the error is printed with its file, line and column,
+// and returned.
+func (s *Session) Batch(paths ...string) error {
+	if len(paths) == 0 {
+		paths = []string{Stdin}
+	}
+	for _, path := range paths {
+		var err error
+		if path == Stdin {
+			err = s.RunScript("<stdin>", s.input)
+		} else {
+			err = s.RunFile(path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.printResult()
+}
+
+// Eval evaluates expr like Batch evaluates a script, and prints the final
+// stack, or only its top.
+func (s *Session) Eval(expr string) error {
+	if err := s.RunScript("", strings.NewReader(expr)); err != nil {
+		return err
+	}
+
+	return s.printResult()
+}
+
+func (s *Session) printResult() error {
+	if !s.topOnly {
+		s.List()
+		return nil
+	}
+	vals := s.engine.Stack().GetNumbers()
+	if len(vals) == 0 {
+		err := errors.New("the stack is empty")
+		fmt.Fprintln(s.error, "error:", err)
+		return err
+	}
+	fmt.Fprintln(s.output, s.engine.Format(vals[len(vals)-1]))
+
+	return nil
+}
@@ -1,54 +1,58 @@
 package shell
 
 import (
-	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/azr4e1/polacco/engine"
+	"github.com/azr4e1/polacco/history"
 	"github.com/azr4e1/polacco/rpn"
 )
 
-var Help = `
-h: print this help
-q: quit
-p: pop and show last element of stack
-r: reset stack
-l: show stack
-
-Supported operations:
-	+: sum
-	-: diff
-	/: div
-	*: mul
-	^: pow
-`
+// ErrQuit is returned by Exec when the expression asks to quit the session.
+var ErrQuit = engine.ErrQuit
 
+// Session is a line-based front end to an engine: it reads lines from its
+// input and prints the output of the engine and its errors.
 type Session struct {
 	input          io.Reader
 	output         io.Writer
 	error          io.Writer
-	stack          *rpn.RPNStack
-	history        []string
+	engine         *engine.Engine
+	backend        rpn.Backend
+	initialStack   []float64
+	base           int
+	precision      int
+	undoDepth      int
 	maxHistorySize int
-	historyPointer int
+	historyFile    string
+	historyMode    history.Mode
 	prompt         string
+	topOnly        bool
 	help           string
+	stateFile      string
+	cleanStart     bool
 }
 
 type option func(*Session) error
 
 func NewSession(opts ...option) (*Session, error) {
-	stack := rpn.NewStack()
 	s := &Session{
 		input:          os.Stdin,
 		output:         os.Stdout,
 		error:          os.Stderr,
-		stack:          stack,
-		maxHistorySize: 50,
-		help:           Help,
+		base:           10,
+		precision:      -1,
+		maxHistorySize: history.DefaultMaxSize,
+		historyMode:    history.IgnoreDups,
+		undoDepth:      rpn.DefaultJournalDepth,
+		help:           engine.Help,
 	}
 
 	for _, o := range opts {
@@ -57,6 +61,37 @@ func NewSession(opts ...option) (*Session, error) {
 			return nil, err
 		}
 	}
+	backend := s.backend
+	if backend == nil {
+		backend = rpn.FloatBackend
+	}
+	var err error
+	s.engine, err = engine.New(
+		engine.SetBackend(backend),
+		engine.SetStack(s.initialStack...),
+		engine.SetBase(s.base),
+		engine.SetPrecision(s.precision),
+		engine.SetUndoDepth(s.undoDepth),
+		engine.SetMaxHistorySize(s.maxHistorySize),
+		engine.SetHistoryFile(s.historyFile),
+		engine.SetHistoryMode(s.historyMode),
+		engine.SetHelp(s.help),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if s.stateFile != "" && !s.cleanStart {
+		err := s.engine.LoadFile(s.stateFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			return s, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := s.engine.ApplySettings(s.backend, s.precision, s.initialStack); err != nil {
+			return nil, err
+		}
+	}
 
 	return s, nil
 }
@@ -94,19 +129,32 @@ func SetStderr(stderr io.Writer) option {
 	}
 }
 
+// SetStack sets the initial values of the stack. A session that restores
+// a state pushes them on the restored stack.
 func SetStack(vals ...float64) option {
 	return func(s *Session) error {
-		stack := rpn.NewStack(vals...)
-		s.stack = stack
+		s.initialStack = vals
 
 		return nil
 	}
 }
 
+// SetBackend sets the number mode of the session. A nil backend keeps the
+// default, FloatBackend, or the mode of the restored state.
+func SetBackend(backend rpn.Backend) option {
+	return func(s *Session) error {
+		s.backend = backend
+		return nil
+	}
+}
+
+// SetMaxHistorySize sets how many lines the history keeps, and the history
+// file is trimmed to. The default is history.DefaultMaxSize; the size must
+// be at least 1.
 func SetMaxHistorySize(maxHistorySize int) option {
 	return func(s *Session) error {
-		if maxHistorySize < 0 {
-			return errors.New("cannot set negative history size")
+		if maxHistorySize < 1 {
+			return errors.New("history size must be at least 1")
 		}
 
 		s.maxHistorySize = maxHistorySize
@@ -114,6 +162,58 @@ func SetMaxHistorySize(maxHistorySize int) option {
 	}
 }
 
+// SetHistoryFile keeps the history in the file at path, such as
+// ~/.polacco_history, so that it carries over to later sessions. An empty
+// path keeps it in memory only.
+func SetHistoryFile(path string) option {
+	return func(s *Session) error {
+		s.historyFile = path
+		return nil
+	}
+}
+
+// SetHistoryMode sets which lines are left out of the history. The
+// default is history.IgnoreDups.
+func SetHistoryMode(mode history.Mode) option {
+	return func(s *Session) error {
+		s.historyMode = mode
+		return nil
+	}
+}
+
+func SetBase(base int) option {
+	return func(s *Session) error {
+		switch base {
+		case 2, 8, 10, 16:
+		default:
+			return fmt.Errorf("unsupported base: %d", base)
+		}
+
+		s.base = base
+		return nil
+	}
+}
+
+// SetPrecision sets how many decimals numbers are printed with. A negative
+// precision keeps the one of the restored state, or prints them in full.
+func SetPrecision(decimals int) option {
+	return func(s *Session) error {
+		s.precision = decimals
+		return nil
+	}
+}
+
+func SetUndoDepth(undoDepth int) option {
+	return func(s *Session) error {
+		if undoDepth < 0 {
+			return errors.New("cannot set negative undo depth")
+		}
+
+		s.undoDepth = undoDepth
+		return nil
+	}
+}
+
 func SetPrompt(prompt string) option {
 	return func(s *Session) error {
 		s.prompt = prompt
@@ -128,97 +228,260 @@ func SetHelp(help string) option {
 	}
 }
 
-func (s *Session) Exec(expr string) {
-	cleanExpr := strings.ToLower(strings.TrimSpace(expr))
-	switch cleanExpr {
-	case "h", "he", "hel", "help":
-		s.Help()
-	case "l", "ls", "li", "lis", "list":
-		s.List()
-	case "p", "po", "pop":
-		s.Pop()
-	case "r", "re", "res", "rese", "reset":
-		s.Reset()
-	case "q", "qu", "qui", "quit":
-		os.Exit(0)
-	default:
-		s.Parse(cleanExpr)
+// SetStateFile makes the session start from the state saved in the file at
+// path, if there is one, and save its state there when Run returns.
+func SetStateFile(path string) option {
+	return func(s *Session) error {
+		s.stateFile = path
+		return nil
+	}
+}
+
+// SetCleanStart makes a session with a state file start afresh instead of
+// restoring it. The state is still saved when Run returns.
+func SetCleanStart(clean bool) option {
+	return func(s *Session) error {
+		s.cleanStart = clean
+		return nil
+	}
+}
+
+// Exec runs the command or evaluates the expression expr with the engine
+// of the session, and prints its output. Errors are printed to the error
+// stream of the session; the only one returned is ErrQuit, when expr asks
+// to quit.
+func (s *Session) Exec(expr string) error {
+	out, err := s.engine.Exec(expr)
+	if errors.Is(err, ErrQuit) {
+		return err
 	}
+	if out != "" {
+		fmt.Fprintln(s.output, out)
+	}
+	if err != nil {
+		s.printError(strings.TrimSpace(expr), err)
+	}
+
+	return nil
 }
 
-func (s *Session) Help() {
-	fmt.Fprintln(s.output, Help)
+// Engine returns the engine the session runs lines with.
+func (s *Session) Engine() *engine.Engine {
+	return s.engine
 }
 
 func (s *Session) List() {
-	fmt.Fprintf(s.output, "%v\n", s.stack.GetValues())
+	fmt.Fprintln(s.output, s.engine.List())
 }
 
-func (s *Session) Pop() {
-	val, err := s.stack.Pop()
+// RunScript runs the script r, called name, with the engine of the
+// session. The error, if any, is printed with the line and column of the
+// failing token in the script, and returned.
+func (s *Session) RunScript(name string, r io.Reader) error {
+	err := s.engine.RunScript(name, r)
 	if err != nil {
-		fmt.Fprintln(s.error, "error:", err)
-		return
+		s.printError("", err)
 	}
-	fmt.Fprintln(s.output, val)
-}
 
-func (s *Session) Reset() {
-	stack := rpn.NewStack()
-	s.stack = stack
+	return err
 }
 
-func (s *Session) Parse(expr string) {
-	err := rpn.StringParser(s.stack, expr)
+// RunFile runs the script in the file at path with RunScript.
+func (s *Session) RunFile(path string) error {
+	err := s.engine.RunFile(path)
 	if err != nil {
-		fmt.Fprintln(s.error, "error:", err)
+		s.printError("", err)
 	}
-}
 
-func (s *Session) GetHistory() []string {
-	return s.history
+	return err
 }
 
-func (s *Session) updateHistory(expr string) {
-	// ignore empty
-	if strings.TrimSpace(expr) == "" {
+// printError prints err, which happened evaluating src, with a caret under
+// the failing token. Errors in scripts are printed with the line and column
+// of the token in the script instead.
+func (s *Session) printError(src string, err error) {
+	name := ""
+	var scriptErr *engine.ScriptError
+	if errors.As(err, &scriptErr) {
+		name, src, err = scriptErr.Name, scriptErr.Source, scriptErr.Err
+	}
+	token, offset, ok := rpn.ErrorToken(err)
+	// an error may point into a source other than src, such as a word
+	// restored from a state file
+	if !ok || offset+len(token) > len(src) {
+		fmt.Fprintln(s.error, "error:", err)
 		return
 	}
-	// ignore repetition
-	if length := len(s.history); length > 0 && s.history[length-1] == expr {
+
+	line, col, text := position(src, offset)
+	lineStart := strings.LastIndexByte(src[:offset], '\n') + 1
+	token, _, _ = strings.Cut(token, "\n")
+	fmt.Fprintln(s.error, text)
+	fmt.Fprintln(s.error, caret(text, token, offset-lineStart))
+	if name == "" {
+		fmt.Fprintln(s.error, "error:", err)
 		return
 	}
-	s.history = append(s.history, expr)
-	s.history = s.history[max(0, len(s.history)-s.maxHistorySize):len(s.history)]
-	s.historyPointer = len(s.history) // reset pointer to last element
+	fmt.Fprintf(s.error, "error: %s:%d:%d: %v\n", name, line, col, err)
 }
 
-func (s *Session) GetPrevHistoryElement() (string, error) {
-	if s.historyPointer <= 0 {
-		s.historyPointer = 0
-		return "", errors.New("earliest point in history")
+// position returns the 1-based line and column of offset in src, and the
+// text of that line.
+func position(src string, offset int) (line, col int, text string) {
+	start := strings.LastIndexByte(src[:offset], '\n') + 1
+	end := strings.IndexByte(src[offset:], '\n')
+	if end < 0 {
+		end = len(src)
+	} else {
+		end += offset
 	}
-	s.historyPointer--
-	return s.history[s.historyPointer], nil
+	line = strings.Count(src[:offset], "\n") + 1
+	col = utf8.RuneCountInString(src[start:offset]) + 1
+
+	return line, col, strings.TrimRight(src[start:end], "\r")
+}
+
+// caret returns a line that marks token, found at offset in expr, when
+// printed under expr.
+func caret(expr, token string, offset int) string {
+	var b strings.Builder
+	for _, ch := range expr[:offset] {
+		// keep tabs so the caret lines up with the expression
+		if ch == '\t' {
+			b.WriteRune(ch)
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+	b.WriteString(strings.Repeat("^", max(1, utf8.RuneCountInString(token))))
+
+	return b.String()
+}
+
+func (s *Session) GetHistory() []string {
+	return s.engine.History()
+}
+
+func (s *Session) GetPrevHistoryElement() (string, error) {
+	return s.engine.PrevHistory()
 }
 
 func (s *Session) GetNextHistoryElement() (string, error) {
-	if s.historyPointer >= len(s.history)-1 {
-		s.historyPointer = len(s.history) - 1
-		return "", errors.New("latest point in history")
+	return s.engine.NextHistory()
+}
+
+// Run reads lines from the input of the session and executes them with
+// Exec until the input ends, a line asks to quit or ctx is done. It
+// returns ctx.Err() if ctx is done, and nil if the session ended normally.
+// A read that is blocked when ctx is done finishes in the background.
+// Either way, the state of the session is then saved to its state file.
+func (s *Session) Run(ctx context.Context) error {
+	err := s.run(ctx)
+	if s.stateFile != "" {
+		if saveErr := s.engine.SaveFile(s.stateFile); saveErr != nil && err == nil {
+			err = saveErr
+		}
 	}
-	s.historyPointer++
-	return s.history[s.historyPointer], nil
+
+	return err
 }
 
-func (s *Session) Run() {
-	fmt.Fprintf(s.output, s.prompt)
-	scanner := bufio.NewScanner(s.input)
-	for scanner.Scan() {
-		expr := scanner.Text()
-		s.updateHistory(expr)
+// inputLine is a line read from the input, or the error that ended it.
+type inputLine struct {
+	text string
+	err  error
+}
+
+func (s *Session) run(ctx context.Context) error {
+	// the reader is stopped when the session ends, and only reads a line
+	// when the session asks for one, so that the input after quit is left
+	// to whoever shares the reader
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	requests := make(chan struct{})
+	lines := make(chan inputLine)
+	go func() {
+		for {
+			select {
+			case <-requests:
+			case <-ctx.Done():
+				return
+			}
+			text, err := readLine(s.input)
+			select {
+			case lines <- inputLine{text, err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	fmt.Fprint(s.output, s.prompt)
+	for {
+		var l inputLine
+		select {
+		case requests <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		select {
+		case l = <-lines:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if errors.Is(l.err, io.EOF) {
+			return nil
+		}
+		if l.err != nil {
+			return l.err
+		}
+		if err := s.Exec(l.text); errors.Is(err, ErrQuit) {
+			return nil
+		}
+		fmt.Fprint(s.output, s.prompt)
+	}
+}
 
-		s.Exec(expr)
-		fmt.Fprintf(s.output, s.prompt)
+// readLine reads a line from r without its line ending. It reads one byte
+// at a time, so that nothing after the line is consumed. The last line
+// needs no line ending; io.EOF is only returned after it.
+func readLine(r io.Reader) (string, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = byteReader{r}
+	}
+	var b []byte
+	for {
+		ch, err := br.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(b) > 0 {
+				break
+			}
+			return "", err
+		}
+		if ch == '\n' {
+			break
+		}
+		b = append(b, ch)
+	}
+
+	return strings.TrimSuffix(string(b), "\r"), nil
+}
+
+// byteReader reads single bytes from an io.Reader.
+type byteReader struct {
+	io.Reader
+}
+
+func (r byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	for {
+		n, err := r.Read(b[:])
+		if n == 1 {
+			return b[0], nil
+		}
+		if err != nil {
+			return 0, err
+		}
 	}
 }
@@ -2,9 +2,18 @@ package shell_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/azr4e1/polacco/rpn"
 	"github.com/azr4e1/polacco/shell"
 	"github.com/google/go-cmp/cmp"
 )
@@ -29,7 +38,7 @@ func TestShellRun_RunsListCorrectly(t *testing.T) {
 		t.Error(err)
 	}
 	want := "> > [6]\n> "
-	session.Run()
+	session.Run(context.Background())
 	got := output.String()
 
 	if want != got {
@@ -57,7 +66,7 @@ func TestShellRun_RunsPopCorrectly(t *testing.T) {
 		t.Error(err)
 	}
 	want := "> > 3\n> "
-	session.Run()
+	session.Run(context.Background())
 	got := output.String()
 
 	if want != got {
@@ -84,8 +93,8 @@ func TestShellRun_PopReturnsErrorCorrectly(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	want := "error: stack is empty\n"
-	session.Run()
+	want := "error: not enough elements in the stack: pop needs 1, have 0\n"
+	session.Run(context.Background())
 	got := error.String()
 
 	if want != got {
@@ -113,7 +122,7 @@ func TestShellRun_ResetRunsCorrectly(t *testing.T) {
 		t.Error(err)
 	}
 	want := "> > > []\n> "
-	session.Run()
+	session.Run(context.Background())
 	got := output.String()
 
 	if want != got {
@@ -140,8 +149,8 @@ func TestShellRun_ReturnsErrorForParsingErrors(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	want := "error: not enough elements in the stack\n"
-	session.Run()
+	want := "3 1 2 + + +\n          ^\nerror: not enough elements in the stack: + needs 2, have 1\n"
+	session.Run(context.Background())
 	got := error.String()
 
 	if want != got {
@@ -165,8 +174,8 @@ func TestShellRun_ReturnsErrorForParsingErrors(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	want = "error: cannot divide by 0\n"
-	session.Run()
+	want = "3 0 /\n    ^\nerror: /: cannot divide by 0\n"
+	session.Run(context.Background())
 	got = error.String()
 
 	if want != got {
@@ -190,8 +199,8 @@ func TestShellRun_ReturnsErrorForParsingErrors(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	want = "error: cannot raise 0 to the power of 0\n"
-	session.Run()
+	want = "0 0 ^\n    ^\nerror: ^: cannot raise 0 to the power of 0\n"
+	session.Run(context.Background())
 	got = error.String()
 
 	if want != got {
@@ -214,8 +223,8 @@ func TestShellRun_ReturnsErrorForParsingErrors(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	want = "error: cannot raise a negative number to a fractional exponent\n"
-	session.Run()
+	want = "0 1 - 1.5 ^\n          ^\nerror: ^: cannot raise a negative number to a fractional exponent\n"
+	session.Run(context.Background())
 	got = error.String()
 
 	if want != got {
@@ -242,7 +251,7 @@ func TestShellRun_StoresHistoryCorrectly(t *testing.T) {
 		t.Error(err)
 	}
 	want := []string{"3 1 2 +  ", "pop", "p", "h", "l  ", "ls", "^", "-"}
-	session.Run()
+	session.Run(context.Background())
 	got := session.GetHistory()
 
 	if !cmp.Equal(want, got) {
@@ -278,7 +287,7 @@ func TestShellRun_MaintainsTheCorrectHistoryLength(t *testing.T) {
 		want = append(want, fmt.Sprintf("ls%d", i))
 	}
 
-	session.Run()
+	session.Run(context.Background())
 	got := session.GetHistory()
 
 	if !cmp.Equal(want, got) {
@@ -305,7 +314,7 @@ func TestShellRunGetPrevHistoryElement_ReturnsTheCorrectElements(t *testing.T) {
 		t.Error(err)
 	}
 	want := "-"
-	session.Run()
+	session.Run(context.Background())
 	got, err := session.GetPrevHistoryElement()
 	if err != nil {
 		t.Fatal(err)
@@ -335,7 +344,7 @@ func TestShellRunGetNextHistoryElement_ReturnsTheCorrectElements(t *testing.T) {
 		t.Error(err)
 	}
 	want := "-"
-	session.Run()
+	session.Run(context.Background())
 	_, err = session.GetPrevHistoryElement()
 	if err != nil {
 		t.Fatal(err)
@@ -372,7 +381,7 @@ func TestShellRunGetPrevHistoryElement_ReturnsError(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	session.Run()
+	session.Run(context.Background())
 	_, err = session.GetPrevHistoryElement()
 	_, err = session.GetPrevHistoryElement()
 	if err == nil {
@@ -398,9 +407,662 @@ func TestShellRunGetNextHistoryElement_ReturnsError(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	session.Run()
+	session.Run(context.Background())
 	_, err = session.GetNextHistoryElement()
 	if err == nil {
 		t.Error("want error, got nil")
 	}
 }
+
+func TestShellRun_HelpListsTheRegisteredOperators(t *testing.T) {
+	t.Parallel()
+	input := new(bytes.Buffer)
+	output := new(bytes.Buffer)
+	error := new(bytes.Buffer)
+	session, err := shell.NewSession(
+		shell.SetStdin(input),
+		shell.SetStdout(output),
+		shell.SetStderr(error),
+	)
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = input.Write([]byte("help\n"))
+	if err != nil {
+		t.Error(err)
+	}
+	session.Run(context.Background())
+	got := output.String()
+
+	for _, want := range []string{"\t+      sum\n", "\tsqrt   square root\n", "\t-rot   "} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want help to contain %q, got %s", want, got)
+		}
+	}
+}
+
+func TestShellRun_FailedExpressionsLeaveTheStackUntouched(t *testing.T) {
+	t.Parallel()
+	input := new(bytes.Buffer)
+	output := new(bytes.Buffer)
+	error := new(bytes.Buffer)
+	session, err := shell.NewSession(
+		shell.SetStdin(input),
+		shell.SetStdout(output),
+		shell.SetStderr(error),
+		shell.SetStack(1, 2),
+	)
+	if err != nil {
+		t.Error(err)
+	}
+	inputStr := "1 2 + 0 /\nls\n"
+	_, err = input.Write([]byte(inputStr))
+	if err != nil {
+		t.Error(err)
+	}
+	want := "[1 2]\n"
+	session.Run(context.Background())
+	got := output.String()
+
+	if want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestShellRun_UndoRestoresTheStackAfterReset(t *testing.T) {
+	t.Parallel()
+	input := new(bytes.Buffer)
+	output := new(bytes.Buffer)
+	error := new(bytes.Buffer)
+	session, err := shell.NewSession(
+		shell.SetStdin(input),
+		shell.SetStdout(output),
+		shell.SetStderr(error),
+	)
+	if err != nil {
+		t.Error(err)
+	}
+	inputStr := "1 2 3\n*\nreset\nundo\nls\nundo\nls\nredo\nls\n"
+	_, err = input.Write([]byte(inputStr))
+	if err != nil {
+		t.Error(err)
+	}
+	want := "[1 6]\n[1 2 3]\n[1 6]\n"
+	session.Run(context.Background())
+	got := output.String()
+
+	if want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestShellRun_UndoReturnsErrorWithEmptyHistory(t *testing.T) {
+	t.Parallel()
+	input := new(bytes.Buffer)
+	output := new(bytes.Buffer)
+	error := new(bytes.Buffer)
+	session, err := shell.NewSession(
+		shell.SetStdin(input),
+		shell.SetStdout(output),
+		shell.SetStderr(error),
+	)
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = input.Write([]byte("undo\n"))
+	if err != nil {
+		t.Error(err)
+	}
+	want := "error: nothing to undo\n"
+	session.Run(context.Background())
+	got := error.String()
+
+	if want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestShellRun_UsesTheSelectedBackend(t *testing.T) {
+	t.Parallel()
+	input := new(bytes.Buffer)
+	output := new(bytes.Buffer)
+	error := new(bytes.Buffer)
+	backend, err := rpn.NewBigFloatBackend(rpn.DefaultPrecision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := shell.NewSession(
+		shell.SetStdin(input),
+		shell.SetStdout(output),
+		shell.SetStderr(error),
+		shell.SetBackend(backend),
+		shell.SetStack(0.5),
+	)
+	if err != nil {
+		t.Error(err)
+	}
+	inputStr := "0.1 0.2 +\nls\npop\n"
+	_, err = input.Write([]byte(inputStr))
+	if err != nil {
+		t.Error(err)
+	}
+	want := "[0.5 0.3]\n0.3\n"
+	session.Run(context.Background())
+	got := output.String()
+
+	if want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestShellRun_ShowsIntegersInTheSelectedBase(t *testing.T) {
+	t.Parallel()
+	input := new(bytes.Buffer)
+	output := new(bytes.Buffer)
+	error := new(bytes.Buffer)
+	backend, err := rpn.NewIntegerBackend(16, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := shell.NewSession(
+		shell.SetStdin(input),
+		shell.SetStdout(output),
+		shell.SetStderr(error),
+		shell.SetBackend(backend),
+	)
+	if err != nil {
+		t.Error(err)
+	}
+	inputStr := "0xff 1 +\nhex\nls\nbin\nls\ndec\npop\n"
+	_, err = input.Write([]byte(inputStr))
+	if err != nil {
+		t.Error(err)
+	}
+	want := "[0x100]\n[0b100000000]\n256\n"
+	session.Run(context.Background())
+	got := output.String()
+
+	if want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestShellRun_ListsAndClearsVariables(t *testing.T) {
+	t.Parallel()
+	input := new(bytes.Buffer)
+	output := new(bytes.Buffer)
+	error := new(bytes.Buffer)
+	session, err := shell.NewSession(
+		shell.SetStdin(input),
+		shell.SetStdout(output),
+		shell.SetStderr(error),
+	)
+	if err != nil {
+		t.Error(err)
+	}
+	inputStr := "2 'x sto\n42 0 sto\nvars\nclvars\nvars\nundo\nx 0 rcl +\nls\n"
+	_, err = input.Write([]byte(inputStr))
+	if err != nil {
+		t.Error(err)
+	}
+	want := "0: 42\nx: 2\n[44]\n"
+	session.Run(context.Background())
+	got := output.String()
+
+	if want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+	if error.Len() != 0 {
+		t.Errorf("want no errors, got %s", error)
+	}
+}
+
+func TestShellRun_ManagesUserDefinedWords(t *testing.T) {
+	t.Parallel()
+	input := new(bytes.Buffer)
+	output := new(bytes.Buffer)
+	error := new(bytes.Buffer)
+	session, err := shell.NewSession(
+		shell.SetStdin(input),
+		shell.SetStdout(output),
+		shell.SetStderr(error),
+	)
+	if err != nil {
+		t.Error(err)
+	}
+	inputStr := ": hyp dup * swap dup * + sqrt ;\n: sq dup * ;\nwords\nsee hyp\n3 4 hyp\nforget sq\nwords\nls\n"
+	_, err = input.Write([]byte(inputStr))
+	if err != nil {
+		t.Error(err)
+	}
+	want := "hyp sq\n: hyp dup * swap dup * + sqrt ;\nhyp\n[5]\n"
+	session.Run(context.Background())
+	got := output.String()
+
+	if want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+	if error.Len() != 0 {
+		t.Errorf("want no errors, got %s", error)
+	}
+}
+
+func TestSessionRunScript_RunsMultiLineScripts(t *testing.T) {
+	t.Parallel()
+	output := new(bytes.Buffer)
+	error := new(bytes.Buffer)
+	session, err := shell.NewSession(
+		shell.SetStdout(output),
+		shell.SetStderr(error),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := `# hypotenuse of a right triangle
+: hyp ( a b -- c )
+  dup * swap dup * + sqrt
+;
+3 4 hyp \ should be 5
+`
+	err = session.RunScript("hyp.rpn", strings.NewReader(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.List()
+
+	want := "[5]\n"
+	if got := output.String(); want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+	if error.Len() != 0 {
+		t.Errorf("want no errors, got %s", error)
+	}
+}
+
+func TestSessionRunScript_ReportsTheLineAndColumnOfErrors(t *testing.T) {
+	t.Parallel()
+	output := new(bytes.Buffer)
+	error := new(bytes.Buffer)
+	session, err := shell.NewSession(
+		shell.SetStdout(output),
+		shell.SetStderr(error),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := "1 2 +\n\t3 0 / # oops\n4\n"
+	err = session.RunScript("bad.rpn", strings.NewReader(script))
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+
+	want := "\t3 0 / # oops\n\t    ^\nerror: bad.rpn:2:6: /: cannot divide by 0\n"
+	if got := error.String(); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	session.List()
+	if got := output.String(); got != "[]\n" {
+		t.Errorf("want the stack untouched, got %s", got)
+	}
+}
+
+func TestShellRun_SourcesScriptFiles(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "Script.rpn")
+	err := os.WriteFile(path, []byte("( double )\n: double 2 * ;\n21 double\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := new(bytes.Buffer)
+	output := new(bytes.Buffer)
+	error := new(bytes.Buffer)
+	session, err := shell.NewSession(
+		shell.SetStdin(input),
+		shell.SetStdout(output),
+		shell.SetStderr(error),
+	)
+	if err != nil {
+		t.Error(err)
+	}
+	inputStr := "source " + path + "\nls\nsource " + path + ".missing\n"
+	_, err = input.Write([]byte(inputStr))
+	if err != nil {
+		t.Error(err)
+	}
+	want := "[42]\n"
+	session.Run(context.Background())
+	got := output.String()
+
+	if want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+	if !strings.HasPrefix(error.String(), "error: open ") {
+		t.Errorf("want an error for the missing file, got %s", error)
+	}
+}
+
+func TestSessionBatch_PrintsTheFinalStack(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.rpn")
+	if err := os.WriteFile(first, []byte("1 2 +\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	second := filepath.Join(dir, "second.rpn")
+	if err := os.WriteFile(second, []byte("# scale it\n10 *\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	type TestCase struct {
+		TopOnly bool
+		Paths   []string
+		Output  string
+	}
+	testCases := []TestCase{
+		{TopOnly: false, Paths: []string{first, second}, Output: "[30]\n"},
+		{TopOnly: false, Paths: []string{first, shell.Stdin}, Output: "[3 4 5]\n"},
+		{TopOnly: false, Paths: nil, Output: "[4 5]\n"},
+		{TopOnly: true, Paths: []string{first, shell.Stdin}, Output: "5\n"},
+	}
+	for _, tc := range testCases {
+		output := new(bytes.Buffer)
+		error := new(bytes.Buffer)
+		session, err := shell.NewSession(
+			shell.SetStdin(strings.NewReader("4 5\n")),
+			shell.SetStdout(output),
+			shell.SetStderr(error),
+			shell.SetTopOnly(tc.TopOnly),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = session.Batch(tc.Paths...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := output.String(); tc.Output != got {
+			t.Errorf("%v: want %q, got %q", tc.Paths, tc.Output, got)
+		}
+		if error.Len() != 0 {
+			t.Errorf("%v: want no errors, got %s", tc.Paths, error)
+		}
+	}
+}
+
+func TestSessionBatch_StopsAtTheFirstError(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.rpn")
+	if err := os.WriteFile(bad, []byte("1\n2 dup +\n  swap drop drop drop\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	never := filepath.Join(dir, "never.rpn")
+	if err := os.WriteFile(never, []byte("42\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := new(bytes.Buffer)
+	error := new(bytes.Buffer)
+	session, err := shell.NewSession(
+		shell.SetStdout(output),
+		shell.SetStderr(error),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = session.Batch(bad, never)
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+	if output.Len() != 0 {
+		t.Errorf("want no output, got %s", output)
+	}
+	want := fmt.Sprintf("  swap drop drop drop\n                 ^^^^\nerror: %s:3:18: not enough elements in the stack: drop needs 1, have 0\n", bad)
+	if got := error.String(); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestSessionBatch_FailsOnAnEmptyStackWhenPrintingTheTop(t *testing.T) {
+	t.Parallel()
+	output := new(bytes.Buffer)
+	error := new(bytes.Buffer)
+	session, err := shell.NewSession(
+		shell.SetStdin(strings.NewReader("1 drop")),
+		shell.SetStdout(output),
+		shell.SetStderr(error),
+		shell.SetTopOnly(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = session.Batch()
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+	if got := error.String(); got != "error: the stack is empty\n" {
+		t.Errorf("want an empty stack error, got %q", got)
+	}
+}
+
+func TestSessionEval_PrintsWithTheSessionPrecision(t *testing.T) {
+	t.Parallel()
+	type TestCase struct {
+		Precision int
+		TopOnly   bool
+		Output    string
+	}
+	testCases := []TestCase{
+		{Precision: -1, TopOnly: false, Output: "[0.5 0.6666666666666666]\n"},
+		{Precision: 2, TopOnly: false, Output: "[0.50 0.67]\n"},
+		{Precision: 0, TopOnly: true, Output: "1\n"},
+	}
+	for _, tc := range testCases {
+		output := new(bytes.Buffer)
+		session, err := shell.NewSession(
+			shell.SetStdout(output),
+			shell.SetStderr(new(bytes.Buffer)),
+			shell.SetPrecision(tc.Precision),
+			shell.SetTopOnly(tc.TopOnly),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := session.Eval("1 2 / 2 3 /"); err != nil {
+			t.Fatal(err)
+		}
+		if got := output.String(); tc.Output != got {
+			t.Errorf("precision %d: want %q, got %q", tc.Precision, tc.Output, got)
+		}
+	}
+}
+
+func TestSessionExec_ReturnsErrQuitOnQuit(t *testing.T) {
+	t.Parallel()
+	session, err := shell.NewSession(
+		shell.SetStdout(new(bytes.Buffer)),
+		shell.SetStderr(new(bytes.Buffer)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expr := range []string{"q", "quit", " QUIT "} {
+		if err := session.Exec(expr); !errors.Is(err, shell.ErrQuit) {
+			t.Errorf("%q: want ErrQuit, got %v", expr, err)
+		}
+	}
+	for _, expr := range []string{"1 2 +", "1 0 /", "ls", "quitting"} {
+		if err := session.Exec(expr); err != nil {
+			t.Errorf("%q: want nil, got %v", expr, err)
+		}
+	}
+}
+
+func TestShellRun_StopsAtQuit(t *testing.T) {
+	t.Parallel()
+	output := new(bytes.Buffer)
+	session, err := shell.NewSession(
+		shell.SetStdin(strings.NewReader("1 2 +\nl\nquit\n4\nl\n")),
+		shell.SetStdout(output),
+		shell.SetStderr(new(bytes.Buffer)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = session.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[3]\n"
+	if got := output.String(); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+// not parallel, so that the goroutines of other tests do not change the
+// count
+func TestShellRun_StopsReadingAtQuit(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for range 10 {
+		input := strings.NewReader("1\nquit\n2\n3\n")
+		session, err := shell.NewSession(
+			// hide the io.ByteReader of strings.Reader
+			shell.SetStdin(struct{ io.Reader }{input}),
+			shell.SetStdout(new(bytes.Buffer)),
+			shell.SetStderr(new(bytes.Buffer)),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := session.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		rest, _ := io.ReadAll(input)
+		if want, got := "2\n3\n", string(rest); want != got {
+			t.Errorf("want %q left in the input, got %q", want, got)
+		}
+	}
+
+	// the readers stop as soon as their session does
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("want %d goroutines, got %d", before, after)
+	}
+}
+
+func TestShellRun_ReturnsWhenTheContextIsDone(t *testing.T) {
+	t.Parallel()
+	// the pipe blocks reads until the test writes to it
+	input, w := io.Pipe()
+	defer w.Close()
+	output := new(bytes.Buffer)
+	session, err := shell.NewSession(
+		shell.SetStdin(input),
+		shell.SetStdout(output),
+		shell.SetStderr(new(bytes.Buffer)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() { errs <- session.Run(ctx) }()
+	if _, err := io.WriteString(w, "1 2 +\n"); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("want context.Canceled, got %v", err)
+	}
+}
+
+func TestShellRun_SavesAndRestoresTheStateFile(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "polacco", "state.json")
+	run := func(input string, clean bool) string {
+		t.Helper()
+		output := new(bytes.Buffer)
+		session, err := shell.NewSession(
+			shell.SetStdin(strings.NewReader(input)),
+			shell.SetStdout(output),
+			shell.SetStderr(output),
+			shell.SetStateFile(path),
+			shell.SetCleanStart(clean),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := session.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return output.String()
+	}
+
+	run(": sq dup * ;\n3 sq 'x sto\n1 2\nquit\n", false)
+	want := "[1 2]\nx: 9\nsq\n"
+	if got := run("l\nvars\nwords\n", false); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if got := run("l\n", true); got != "[]\n" {
+		t.Errorf("want a clean session, got %q", got)
+	}
+	// the clean session was saved in turn
+	if got := run("l\nwords\n", false); got != "[]\n" {
+		t.Errorf("want the clean session, got %q", got)
+	}
+}
+
+func TestNewSession_ReturnsErrorForAnInvalidStateFile(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := shell.NewSession(shell.SetStateFile(path))
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+	_, err = shell.NewSession(shell.SetStateFile(path), shell.SetCleanStart(true))
+	if err != nil {
+		t.Errorf("want a clean start to ignore the file, got %v", err)
+	}
+}
+
+func TestShellRun_PrintsErrorsInLoadedWordsWithoutACaret(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "state.json")
+	state := `{"version": 1, "mode": "float", "base": 10, "words": [{"name": "w", "source": "1 2 3 4 5 6 7 8 9 10 11 1.2.3"}]}`
+	if err := os.WriteFile(path, []byte(state), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := new(bytes.Buffer)
+	session, err := shell.NewSession(
+		shell.SetStdin(strings.NewReader("load "+path+"\n")),
+		shell.SetStdout(output),
+		shell.SetStderr(output),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := session.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := output.String()
+	if !strings.HasPrefix(got, "error: "+path+": cannot define w: ") || strings.Contains(got, "^") {
+		t.Errorf("want the error without a caret, got %q", got)
+	}
+}
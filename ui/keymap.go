@@ -18,6 +18,8 @@ type KeyMap struct {
 	Delete    key.Binding
 	Backspace key.Binding
 	Esc       key.Binding
+	Undo      key.Binding
+	Redo      key.Binding
 }
 
 var DefaultKeyMap = KeyMap{
@@ -69,4 +71,12 @@ var DefaultKeyMap = KeyMap{
 	Esc: key.NewBinding(
 		key.WithKeys("esc"),
 	),
+	Undo: key.NewBinding(
+		key.WithKeys("ctrl+z"),
+		key.WithHelp("C-z", "undo"),
+	),
+	Redo: key.NewBinding(
+		key.WithKeys("ctrl+y"),
+		key.WithHelp("C-y", "redo"),
+	),
 }
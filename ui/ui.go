@@ -3,15 +3,19 @@ package ui
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"strings"
 
 	"github.com/azr4e1/polacco/button"
+	"github.com/azr4e1/polacco/engine"
+	"github.com/azr4e1/polacco/history"
 	"github.com/azr4e1/polacco/readline"
 	"github.com/azr4e1/polacco/rpn"
 	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/rivo/uniseg"
 )
 
 const TAB = "\t"
@@ -20,27 +24,35 @@ const BUTNHEIGHT = 3
 const ROWLEN = 4
 const TOTALWIDTH = (2 + BUTNWIDTH) * ROWLEN
 
-// 4 for the readline, 3 for the stack
-const TOTALHEIGHT = 4 + 3 + 4*(BUTNHEIGHT+2)
+// 4 for the readline, 3 for the stack, 3 for the variables
+const TOTALHEIGHT = 4 + 3 + 3 + 4*(BUTNHEIGHT+2)
 
-var Help = `pop:   pop last element from stack
-list:  show stack
-reset: reset stack
-quit:  quit
-`
+// HELPOPLINES is how many lines of operators the help shows.
+const HELPOPLINES = 2
 
 var HelpStyle = lipgloss.NewStyle().Italic(true).Foreground(lipgloss.Color("#71797E"))
 
 type model struct {
-	rl            readline.Model
-	stack         *rpn.RPNStack
-	currentOutput string
-	outputStyle   lipgloss.Style
-	borderStyle   lipgloss.Style
-	history       string
-	quitting      bool
-	buttons       []button.Model
-	error         error
+	rl             readline.Model
+	engine         *engine.Engine
+	backend        rpn.Backend
+	initialStack   []float64
+	precision      int
+	stackDecimals  int
+	outputDecimals int
+	currentOutput  string
+	outputStyle    lipgloss.Style
+	borderStyle    lipgloss.Style
+	history        string
+	quitting       bool
+	buttons        []button.Model
+	error          error
+	stateFile      string
+	cleanStart     bool
+	historyFile    string
+	historyMode    history.Mode
+	historySize    int
+	help           string
 }
 
 func (m model) Init() tea.Cmd {
@@ -51,7 +63,7 @@ func paddingRight(output, padChar string, padLength int) string {
 	lines := strings.Split(output, "\n")
 	result := []string{}
 	for _, line := range lines {
-		diff := padLength - len(line)
+		diff := padLength - lipgloss.Width(line)
 		if diff > 0 {
 			line += strings.Repeat(padChar, diff)
 		}
@@ -70,13 +82,13 @@ func (m model) View() string {
 	}
 	// readline
 	output := m.rl.View()
-	resultOutput := m.currentOutput
-	if len(resultOutput) > m.rl.Width+len(m.rl.Prompt)-2 {
-		resultOutput = resultOutput[len(resultOutput)-m.rl.Width-len(m.rl.Prompt)+2:]
-	}
+	resultOutput := truncateLeft(m.currentOutput, m.rl.Width+lipgloss.Width(m.rl.Prompt)-2)
 	resultOutput = m.outputStyle.Render(resultOutput)
 
-	output = lipgloss.JoinVertical(lipgloss.Left, output, resultOutput)
+	// the status line of a search takes the place of the output
+	if !m.rl.Searching() {
+		output = lipgloss.JoinVertical(lipgloss.Left, output, resultOutput)
+	}
 	output = m.borderStyle.Render(output)
 
 	// keyboard
@@ -100,13 +112,13 @@ func (m model) View() string {
 	output = lipgloss.JoinVertical(lipgloss.Left, output, keyboard)
 
 	// stack
-	stack := m.stack.GetValues()
+	stack := m.engine.Stack().GetNumbers()
 	stackLength := 0
 	stackEls := []string{}
 	truncated := false
 	for i := len(stack) - 1; i >= 0; i-- {
-		stackEl := fmt.Sprintf("%.2f", stack[i])
-		stackLength += len(stackEl) + 2
+		stackEl := rpn.FormatDecimals(m.engine.Stack().Backend(), stack[i], m.stackDecimals, m.engine.Base())
+		stackLength += lipgloss.Width(stackEl) + 2
 		if stackLength+5 > TOTALWIDTH {
 			truncated = true
 			break
@@ -123,12 +135,53 @@ func (m model) View() string {
 
 	output = lipgloss.JoinVertical(lipgloss.Left, output, stackString)
 
+	// variables
+	if vars := m.varsView(); vars != "" {
+		output = lipgloss.JoinVertical(lipgloss.Left, output, vars)
+	}
+
 	// help
-	output += fmt.Sprintf("\n%s", HelpStyle.Render(Help))
+	output += fmt.Sprintf("\n%s", HelpStyle.Render(m.help))
 
 	return output
 }
 
+// truncateLeft drops the grapheme clusters at the start of s until it takes
+// at most width cells, keeping the end of s in view.
+func truncateLeft(s string, width int) string {
+	total, state := uniseg.StringWidth(s), -1
+	for total > width {
+		var w int
+		_, s, w, state = uniseg.FirstGraphemeClusterInString(s, state)
+		total -= w
+	}
+
+	return s
+}
+
+// varsView renders the variables and registers in a single bordered line,
+// or nothing if there are none.
+func (m model) varsView() string {
+	names := m.engine.Stack().VariableNames()
+	if len(names) == 0 {
+		return ""
+	}
+	vars := m.engine.Stack().Variables()
+	els := []string{}
+	length := 0
+	for _, name := range names {
+		el := fmt.Sprintf("%s=%s", name, rpn.FormatDecimals(m.engine.Stack().Backend(), vars[name], m.stackDecimals, m.engine.Base()))
+		length += lipgloss.Width(el) + 2
+		if length+5 > TOTALWIDTH {
+			els = append(els, "...")
+			break
+		}
+		els = append(els, el)
+	}
+
+	return m.borderStyle.Width(TOTALWIDTH - 2).Render(m.outputStyle.Render(strings.Join(els, "  ")))
+}
+
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	if m.quitting {
 		return m, tea.Quit
@@ -139,7 +192,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.error = errors.New("Window width is too small.")
 			return m, tea.Quit
 		}
-		totalHeight := TOTALHEIGHT + len(strings.Split(Help, "\n"))
+		totalHeight := TOTALHEIGHT + len(strings.Split(m.help, "\n"))
 		if msg.Height-1 < totalHeight {
 			m.error = errors.New("Window height is too small.")
 			return m, tea.Quit
@@ -149,6 +202,12 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case key.Matches(msg, DefaultKeyMap.Quit):
 			m.quitting = true
 			return m, tea.Quit
+		case key.Matches(msg, DefaultKeyMap.Undo):
+			m.actionUndo()
+			return m, nil
+		case key.Matches(msg, DefaultKeyMap.Redo):
+			m.actionRedo()
+			return m, nil
 		}
 
 	case readline.ReadlineMsg:
@@ -170,56 +229,266 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
-func initialModel() tea.Model {
-	stack := rpn.NewStack()
+type option func(*model) error
+
+// SetBackend sets the numeric backend of the calculator. A nil backend
+// keeps the default, FloatBackend, or the mode of the restored state.
+func SetBackend(backend rpn.Backend) option {
+	return func(m *model) error {
+		m.backend = backend
+		return nil
+	}
+}
+
+// SetStack sets the initial values of the stack. A calculator that
+// restores a state pushes them on the restored stack.
+func SetStack(vals ...float64) option {
+	return func(m *model) error {
+		m.initialStack = vals
+		return nil
+	}
+}
+
+// SetPrecision sets how many decimals numbers are shown with; a negative
+// precision keeps the default of each panel, or the precision of the
+// restored state.
+func SetPrecision(decimals int) option {
+	return func(m *model) error {
+		m.precision = decimals
+		if decimals < 0 {
+			return nil
+		}
+
+		m.stackDecimals = decimals
+		m.outputDecimals = decimals
+		return nil
+	}
+}
+
+// SetStateFile makes the calculator start from the state saved in the file
+// at path, if there is one, and save its state there on exit.
+func SetStateFile(path string) option {
+	return func(m *model) error {
+		m.stateFile = path
+		return nil
+	}
+}
+
+// SetCleanStart makes a calculator with a state file start afresh instead
+// of restoring it. The state is still saved on exit.
+func SetCleanStart(clean bool) option {
+	return func(m *model) error {
+		m.cleanStart = clean
+		return nil
+	}
+}
+
+// SetHistoryFile keeps the history of the readline in the file at path,
+// shared with other sessions. An empty path keeps it in memory only.
+func SetHistoryFile(path string) option {
+	return func(m *model) error {
+		m.historyFile = path
+		return nil
+	}
+}
+
+// SetHistoryMode sets which lines are left out of the history.
+func SetHistoryMode(mode history.Mode) option {
+	return func(m *model) error {
+		m.historyMode = mode
+		return nil
+	}
+}
+
+// SetMaxHistorySize sets how many lines the history keeps, and the history
+// file is trimmed to. The size must be at least 1.
+func SetMaxHistorySize(size int) option {
+	return func(m *model) error {
+		if size < 1 {
+			return errors.New("history size must be at least 1")
+		}
+		m.historySize = size
+		return nil
+	}
+}
+
+func initialModel(opts ...option) (model, error) {
 	buttons := []button.Model{}
 	for id, label := range []string{"7", "8", "9", "+", "4", "5", "6", "-", "1", "2", "3", "*", "0", ".", "^", "/"} {
 		trigger := key.NewBinding(key.WithKeys(label))
 		btn := button.New(label, id, trigger, button.SetWidth(BUTNWIDTH), button.SetHeight(BUTNHEIGHT))
 		buttons = append(buttons, btn)
 	}
-	// 2 accounts for the border width
-	rl := readline.New(readline.SetWidth(TOTALWIDTH - 2))
-	return model{
-		stack:       stack,
-		rl:          rl,
-		outputStyle: lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#870087")),
-		borderStyle: lipgloss.NewStyle().BorderStyle(lipgloss.NormalBorder()).BorderForeground(lipgloss.Color("#3C3C3C")),
-		buttons:     buttons,
+	m := model{
+		precision:      -1,
+		stackDecimals:  2,
+		outputDecimals: 6,
+		historyMode:    history.IgnoreDups,
+		historySize:    history.DefaultMaxSize,
+		outputStyle:    lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#870087")),
+		borderStyle:    lipgloss.NewStyle().BorderStyle(lipgloss.NormalBorder()).BorderForeground(lipgloss.Color("#3C3C3C")),
+		buttons:        buttons,
+		help:           help(TOTALWIDTH),
+	}
+	for _, o := range opts {
+		if err := o(&m); err != nil {
+			return model{}, err
+		}
+	}
+	// 2 accounts for the border width. The readline keeps the history
+	// file, so the engine does not append to it a second time.
+	m.rl = readline.New(
+		readline.SetWidth(TOTALWIDTH-2),
+		readline.SetPrefixSearch(true),
+		readline.SetHistoryFile(m.historyFile),
+		readline.SetHistoryMode(m.historyMode),
+		readline.SetMaxHistory(m.historySize),
+	)
+	backend := m.backend
+	if backend == nil {
+		backend = rpn.FloatBackend
+	}
+	var err error
+	m.engine, err = engine.New(
+		engine.SetBackend(backend),
+		engine.SetStack(m.initialStack...),
+		engine.SetPrecision(m.precision),
+		engine.SetDefaultPrecision(m.outputDecimals),
+		engine.SetMaxHistorySize(m.historySize),
+	)
+	if err != nil {
+		return model{}, err
+	}
+	if m.stateFile != "" && !m.cleanStart {
+		err := m.engine.LoadFile(m.stateFile)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return model{}, err
+		default:
+			if err := m.engine.ApplySettings(m.backend, m.precision, m.initialStack); err != nil {
+				return model{}, err
+			}
+			if m.historyFile == "" {
+				m.rl.SetHistory(m.engine.History())
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// help returns the help shown under the calculator, made of the key
+// bindings, the commands of the engine and the operators, wrapped to width.
+func help(width int) string {
+	keys := []string{}
+	for _, b := range []key.Binding{DefaultKeyMap.Undo, DefaultKeyMap.Redo, readline.DefaultKeyMap.Search, DefaultKeyMap.Quit} {
+		keys = append(keys, b.Help().Key+" "+b.Help().Desc)
+	}
+	cmds := []string{}
+	for _, cmd := range engine.Commands() {
+		cmds = append(cmds, strings.TrimSpace(cmd.Name+" "+cmd.Arg))
 	}
+	ops := []string{}
+	for _, op := range rpn.Operators() {
+		ops = append(ops, op.Name)
+	}
+
+	lines := wrap("keys: ", keys, ", ", width)
+	lines = append(lines, wrap("cmds: ", cmds, ", ", width)...)
+	opLines := wrap("ops:  ", ops, " ", width)
+	if len(opLines) > HELPOPLINES {
+		// drop the last operators of the line to make room for the dots
+		last := opLines[HELPOPLINES-1]
+		for lipgloss.Width(last+" ...") > width {
+			last = last[:strings.LastIndexByte(last, ' ')]
+		}
+		opLines = append(opLines[:HELPOPLINES-1], last+" ...")
+	}
+	lines = append(lines, opLines...)
+
+	return strings.Join(lines, "\n")
+}
+
+// wrap joins items with sep into lines of at most width cells, the first
+// one starting with label and the others indented under it.
+func wrap(label string, items []string, sep string, width int) []string {
+	indent := strings.Repeat(" ", lipgloss.Width(label))
+	lines := []string{}
+	line, empty := label, true
+	for i, item := range items {
+		if i < len(items)-1 {
+			item += strings.TrimRight(sep, " ")
+		}
+		if !empty && lipgloss.Width(line+" "+item) > width {
+			lines = append(lines, line)
+			line, empty = indent, true
+		}
+		if !empty {
+			line += " "
+		}
+		line += item
+		empty = false
+	}
+
+	return append(lines, line)
 }
 
 func (m *model) actionParse(input string) {
-	cleanExpr := strings.ToLower(strings.TrimSpace(input))
-	switch cleanExpr {
-	case "q", "qu", "qui", "quit":
+	out, err := m.engine.Exec(input)
+	var scriptErr *engine.ScriptError
+	switch {
+	case errors.Is(err, engine.ErrQuit):
 		m.quitting = true
-	case "l", "ls", "li", "lis", "list":
-		m.currentOutput = fmt.Sprintf("%v", m.stack.GetValues())
-	case "p", "po", "pop":
-		val, err := m.stack.Pop()
-		if err != nil {
-			m.currentOutput = fmt.Sprint("error: ", err)
-			return
-		}
-		m.currentOutput = fmt.Sprintf("%f", val)
-	case "r", "re", "res", "rese", "reset":
-		m.stack = rpn.NewStack()
-		m.currentOutput = ""
-	default:
-		err := rpn.StringParser(m.stack, cleanExpr)
-		if err != nil {
-			m.currentOutput = fmt.Sprint("error: ", err)
-			return
+	case err != nil:
+		m.currentOutput = fmt.Sprint("error: ", err)
+		// a failing expression leaves the stack untouched and is given back
+		// to the readline with the failing token highlighted
+		if token, offset, ok := rpn.ErrorToken(err); ok && !errors.As(err, &scriptErr) {
+			m.rl.SetValue(strings.TrimSpace(input))
+			m.rl.Highlight(offset, offset+len(token))
 		}
-		m.currentOutput = ""
+	default:
+		// output spanning several lines, such as vars, fits on one
+		m.currentOutput = strings.ReplaceAll(out, "\n", "  ")
 	}
 }
 
-func Main() int {
-	p := tea.NewProgram(initialModel())
-	if _, err := p.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v", err)
+func (m *model) actionUndo() {
+	expr, err := m.engine.Undo()
+	if err != nil {
+		m.currentOutput = fmt.Sprint("error: ", err)
+		return
+	}
+	m.currentOutput = fmt.Sprint("undo: ", expr)
+}
+
+func (m *model) actionRedo() {
+	expr, err := m.engine.Redo()
+	if err != nil {
+		m.currentOutput = fmt.Sprint("error: ", err)
+		return
+	}
+	m.currentOutput = fmt.Sprint("redo: ", expr)
+}
+
+func Main(opts ...option) int {
+	m, err := initialModel(opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	p := tea.NewProgram(m)
+	_, err = p.Run()
+	// the engine is shared by every copy of the model, so it holds the
+	// final state
+	if m.stateFile != "" {
+		if saveErr := m.engine.SaveFile(m.stateFile); saveErr != nil && err == nil {
+			err = saveErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		return 1
 	}
 